@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"lit/index"
 
 	"github.com/spf13/cobra"
 )
@@ -13,14 +12,20 @@ var (
 		Short: "adds things to the index",
 		Long:  "recursively adds files of the folder to the index",
 		Run: func(cmd *cobra.Command, args []string) {
-			if !IsRepo() {
-				fmt.Println("fatal: not a repository!")
+			r := openRepo()
+
+			if r == nil {
 				return
 			}
 
-			path := args[0]
+			path, err := r.RelPath(".", args[0])
+
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
 
-			err := index.Stage(path)
+			err = r.Add(path)
 
 			if err != nil {
 				fmt.Println(err)
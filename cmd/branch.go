@@ -3,91 +3,178 @@ package cmd
 import (
 	"errors"
 	"fmt"
-	"lit/refs"
+	"lit/repo"
 
 	"github.com/spf13/cobra"
 )
 
-func DisplayBranches() {
-	headContent, err := refs.ReadHead()
+func DisplayBranches(r *repo.Repository, pattern string, verbose bool) {
+	branches, err := r.Branches(pattern)
 
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
 
-	names := refs.GetBranchNames()
+	if !verbose {
+		for _, branch := range branches {
+			fmt.Print(branch.Name)
 
-	if names == nil {
-		fmt.Println("Error while reading branches")
+			if branch.Current {
+				fmt.Print(" *")
+			}
+			fmt.Print("\n")
+		}
+
+		return
 	}
 
-	for _, branch := range names {
-		fmt.Print(branch)
+	width := 0
 
-		if !headContent.Detached && branch == headContent.Location {
-			fmt.Print(" *")
+	for _, branch := range branches {
+		if len(branch.Name) > width {
+			width = len(branch.Name)
 		}
-		fmt.Print("\n")
+	}
+
+	for _, branch := range branches {
+		marker := " "
+
+		if branch.Current {
+			marker = "*"
+		}
+
+		// symbolic branches pointing to refs without commits have no commit to show
+		if branch.Hash == "" {
+			fmt.Printf("%s %-*s -> %s\n", marker, width, branch.Name, branch.Target)
+			continue
+		}
+
+		fmt.Printf("%s %-*s %s %s\n", marker, width, branch.Name, abbreviate(r, branch.Hash), branch.Subject)
 	}
 }
 
+// copyBranch renames or copies the branch named by args, which are either
+// <old> <new> or just <new> for the current branch.
+func copyBranch(r *repo.Repository, args []string, move bool) error {
+	old, new := "", args[0]
+
+	if len(args) > 1 {
+		old, new = args[0], args[1]
+	} else {
+		hc, err := r.Refs.ReadHead()
+
+		if err != nil {
+			return err
+		}
+
+		if hc.Detached {
+			return errors.New("HEAD is detached, name the branch to rename or copy")
+		}
+
+		old = hc.Location
+	}
+
+	if move {
+		return r.RenameBranch(old, new)
+	}
+
+	return r.CopyBranch(old, new)
+}
+
 var (
 	Branch = cobra.Command{
-		Use:   "branch <name>",
+		Use:   "branch [<name> [<start-point>]]",
 		Short: "manipulates branches",
-		Long:  "creates a new branch with name <name> if provided, else lists branches",
+		Long:  "creates a new branch with name <name> pointing to <start-point>, or HEAD if omitted, if provided, else lists branches. With -m or -c, renames or copies the branch <name> to <start-point>, or the current branch to <name>. With -l or -v, lists the branches matching the glob pattern <name>, -v also showing the commit each branch points to",
 		Run: func(cmd *cobra.Command, args []string) {
-			if !IsRepo() {
-				fmt.Println("fatal: not a repository!")
+			r := openRepo()
+
+			if r == nil {
 				return
 			}
 
-			if len(args) == 0 {
-				DisplayBranches()
+			list, err := cmd.Flags().GetBool("list")
+
+			if err != nil {
+				panic(err)
+			}
+
+			verbose, err := cmd.Flags().GetBool("verbose")
+
+			if err != nil {
+				panic(err)
+			}
+
+			if len(args) == 0 || list || verbose {
+				pattern := ""
+
+				if len(args) > 0 {
+					pattern = args[0]
+				}
+
+				DisplayBranches(r, pattern, verbose)
 				return
 			}
 
-			
 			deleteFlag, err := cmd.Flags().GetBool("delete")
 
 			if err != nil {
 				panic(err)
 			}
-			
+
+			move, err := cmd.Flags().GetBool("move")
+
+			if err != nil {
+				panic(err)
+			}
+
+			copyFlag, err := cmd.Flags().GetBool("copy")
+
+			if err != nil {
+				panic(err)
+			}
+
 			name := args[0]
-			
-			if deleteFlag {
-				err = refs.DeleteBranchSafe(name)
 
-				if err != nil {
+			if move || copyFlag {
+				if err = copyBranch(r, args, move); err != nil {
 					fmt.Println(err)
 				}
-			} else {
-				headCommit, err := refs.HeadCommit()
+			} else if deleteFlag {
+				err = r.DeleteBranch(name)
 
 				if err != nil {
-					if errors.Is(err, refs.ErrNotFound) {
-						fmt.Println("Could not create branch: head does not point to a commit yet")
-						return
-					}
+					fmt.Println(err)
+				}
+			} else if len(args) > 1 {
+				err = r.CreateBranchAt(name, args[1])
 
+				if err != nil {
 					fmt.Println(err)
-					return
 				}
+			} else {
+				err = r.CreateBranch(name)
 
-				err = refs.CreateBranchTo(name, headCommit)
+				if errors.Is(err, repo.ErrNoCommits) {
+					fmt.Println("Could not create branch: head does not point to a commit yet")
+					return
+				}
 
 				if err != nil {
 					fmt.Println(err)
 				}
 			}
 		},
-		Args: cobra.MaximumNArgs(1),
+		Args: cobra.MaximumNArgs(2),
 	}
 )
 
 func init() {
 	RootCmd.AddCommand(&Branch)
 	Branch.Flags().BoolP("delete", "d", false, "deletes branch instead of creating it")
+	Branch.Flags().BoolP("move", "m", false, "renames a branch, keeping HEAD on it if it is the current branch")
+	Branch.Flags().BoolP("copy", "c", false, "copies a branch together with its reflog")
+	Branch.Flags().BoolP("list", "l", false, "lists the branches matching a glob pattern")
+	Branch.Flags().BoolP("verbose", "v", false, "lists branches with the hash and subject of their commit")
 }
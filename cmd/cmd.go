@@ -1,26 +1,120 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"lit/objects"
+	"lit/repo"
 	"os"
 
 	"github.com/spf13/cobra"
 )
 
+const (
+	// EnvDir names the environment variable overriding the location of the lit directory.
+	EnvDir = "LIT_DIR"
+	// EnvWorkTree names the environment variable overriding the location of the working tree.
+	EnvWorkTree = "LIT_WORK_TREE"
+)
+
 var (
 	RootCmd = cobra.Command{
 		Use:   "lit",
 		Short: "a git clone",
 		Long:  "a minimalistic version management system that works similarly to git",
+		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+			dir, err := cmd.Flags().GetString("directory")
+
+			if err != nil {
+				panic(err)
+			}
+
+			if dir == "" {
+				return nil
+			}
+
+			return os.Chdir(dir)
+		},
+		PersistentPostRun: func(cmd *cobra.Command, _ []string) {
+			showStats, err := cmd.Flags().GetBool("cache-stats")
+
+			if err != nil {
+				panic(err)
+			}
+
+			if showStats {
+				stats := objects.DefaultCache.Stats()
+				fmt.Fprintf(os.Stderr, "object cache: %d hits, %d misses, %d evictions, %d cached\n", stats.Hits, stats.Misses, stats.Evictions, stats.Len)
+			}
+		},
 	}
 )
 
-// IsRepo checks if the current working directory contains a .lit folder.
-func IsRepo() bool {
-	stat, err := os.Stat("./.lit/")
-	return err == nil && stat.IsDir()
+// discoverRepo opens the repository the current working directory belongs to,
+// honoring the LIT_DIR and LIT_WORK_TREE environment variables. As with git,
+// setting LIT_DIR alone makes the current working directory the working tree.
+func discoverRepo() (*repo.Repository, error) {
+	dir := os.Getenv(EnvDir)
+	workTree := os.Getenv(EnvWorkTree)
+
+	if dir != "" {
+		if workTree == "" {
+			workTree = "."
+		}
+
+		return repo.OpenDir(workTree, dir)
+	}
+
+	r, err := repo.Discover(".")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if workTree != "" {
+		return repo.OpenDir(workTree, r.Dir)
+	}
+
+	return r, nil
+}
+
+// openRepo opens the repository the current working directory belongs to,
+// printing an error and returning nil if there is none.
+func openRepo() *repo.Repository {
+	r, err := discoverRepo()
+
+	if errors.Is(err, repo.ErrUnsupportedVersion) || errors.Is(err, repo.ErrUnsupportedFeature) {
+		fmt.Println("fatal:", err)
+		return nil
+	}
+
+	if err != nil {
+		fmt.Println("fatal: not a repository!")
+		return nil
+	}
+
+	return r
+}
+
+// displayPath converts a path relative to the working tree of r into one
+// relative to the current working directory.
+func displayPath(r *repo.Repository, path string) string {
+	return r.DisplayPath(".", path)
+}
+
+// abbreviate shortens a hash of an object of r for display, keeping it long
+// enough to tell it apart from every other object.
+func abbreviate(r *repo.Repository, hash string) string {
+	return objects.Abbreviate(r.Objects, hash, objects.DefaultAbbrevLength)
 }
 
 // Execute executes the root command
 func Execute() error {
 	return RootCmd.Execute()
 }
+
+func init() {
+	RootCmd.PersistentFlags().StringP("directory", "C", "", "run as if lit was started in the given directory")
+	RootCmd.PersistentFlags().Bool("cache-stats", false, "print the hit and miss counters of the object cache when done")
+	RootCmd.PersistentFlags().MarkHidden("cache-stats")
+}
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"lit/index"
 
 	"github.com/spf13/cobra"
 )
@@ -13,12 +12,13 @@ var (
 		Short: "shows commits",
 		Long:  "shows every commit upstream of the current commit",
 		Run: func(_ *cobra.Command, args []string) {
-			if !IsRepo() {
-				fmt.Println("fatal: not a repository!")
+			r := openRepo()
+
+			if r == nil {
 				return
 			}
-			
-			_, err := index.Commit(args[0])
+
+			_, err := r.Commit(args[0])
 
 			if err != nil {
 				fmt.Println("Couldn't commit:", err)
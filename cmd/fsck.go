@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"lit/repo"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	Fsck = cobra.Command{
+		Use:   "fsck",
+		Short: "verifies the repository",
+		Long:  "verifies every object reachable from HEAD, the refs, the reflogs and the index, reporting missing and corrupt objects, broken refs, index entries referencing missing blobs and dangling objects",
+		Run: func(cmd *cobra.Command, _ []string) {
+			r := openRepo()
+
+			if r == nil {
+				return
+			}
+
+			showUnreachable, err := cmd.Flags().GetBool("unreachable")
+
+			if err != nil {
+				panic(err)
+			}
+
+			lostFound, err := cmd.Flags().GetBool("lost-found")
+
+			if err != nil {
+				panic(err)
+			}
+
+			report, err := r.Fsck(repo.FsckOptions{LostFound: lostFound})
+
+			if err != nil {
+				fmt.Println("Couldn't check the repository:", err)
+				return
+			}
+
+			for _, problem := range report.BrokenRefs {
+				fmt.Printf("broken ref %s: %v\n", problem.Name, problem.Err)
+			}
+
+			for _, problem := range report.Corrupt {
+				fmt.Printf("corrupt object %s: %v\n", problem.Name, problem.Err)
+			}
+
+			for _, object := range report.Missing {
+				// refs other than branches may point to objects of any type
+				objType := object.Type
+
+				if objType == "" {
+					objType = "object"
+				}
+
+				fmt.Printf("missing %s %s (referenced by %s)\n", objType, object.Hash, object.ReferencedBy)
+			}
+
+			if showUnreachable {
+				for _, object := range report.Unreachable {
+					fmt.Printf("unreachable %s %s\n", object.Type, object.Hash)
+				}
+			} else {
+				for _, object := range report.Dangling {
+					fmt.Printf("dangling %s %s\n", object.Type, object.Hash)
+				}
+			}
+
+			for _, path := range report.LostFound {
+				fmt.Println("wrote", path)
+			}
+
+			if report.OK() {
+				fmt.Println("No problems found.")
+			}
+		},
+		Args: cobra.NoArgs,
+	}
+)
+
+func init() {
+	RootCmd.AddCommand(&Fsck)
+	Fsck.Flags().Bool("unreachable", false, "list every unreachable object instead of only dangling ones")
+	Fsck.Flags().Bool("lost-found", false, "write dangling commits into .lit/lost-found/commit")
+}
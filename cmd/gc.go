@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"lit/repo"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	GC = cobra.Command{
+		Use:   "gc",
+		Short: "removes unreachable objects",
+		Long:  "expires old reflog entries, then removes the loose objects that are not reachable from HEAD, a ref, a reflog or the index and are older than the grace period",
+		Run: func(cmd *cobra.Command, _ []string) {
+			r := openRepo()
+
+			if r == nil {
+				return
+			}
+
+			options := repo.GCOptions{}
+
+			if cmd.Flags().Changed("prune") {
+				prune, err := cmd.Flags().GetString("prune")
+
+				if err != nil {
+					panic(err)
+				}
+
+				gracePeriod, err := parseGracePeriod(prune)
+
+				if err != nil {
+					fmt.Println("Invalid grace period:", prune)
+					return
+				}
+
+				options.GracePeriod = &gracePeriod
+			}
+
+			if cmd.Flags().Changed("reflog-expire") {
+				expire, err := cmd.Flags().GetString("reflog-expire")
+
+				if err != nil {
+					panic(err)
+				}
+
+				reflogExpiry, err := parseGracePeriod(expire)
+
+				if err != nil {
+					fmt.Println("Invalid reflog expiry:", expire)
+					return
+				}
+
+				options.ReflogExpiry = &reflogExpiry
+			}
+
+			result, err := r.GC(options)
+
+			if err != nil {
+				fmt.Println("Couldn't collect garbage:", err)
+				return
+			}
+
+			if result.ExpiredReflogEntries > 0 {
+				fmt.Printf("Expired %d reflog entries.\n", result.ExpiredReflogEntries)
+			}
+
+			fmt.Printf("Removed %d unreachable objects, reclaiming %d bytes (%d objects reachable).\n", result.Objects, result.Bytes, result.Reachable)
+		},
+		Args: cobra.NoArgs,
+	}
+)
+
+// parseGracePeriod parses a duration such as "72h", or "now" for no grace period.
+func parseGracePeriod(value string) (time.Duration, error) {
+	if value == "now" {
+		return 0, nil
+	}
+
+	return time.ParseDuration(value)
+}
+
+func init() {
+	RootCmd.AddCommand(&GC)
+	GC.Flags().String("prune", "", `only remove unreachable objects older than this duration, e.g. "72h" or "now" (default from the config, or 336h)`)
+	GC.Flags().String("reflog-expire", "", `remove reflog entries older than this duration, e.g. "720h" or "now" (default from the config, or 2160h)`)
+}
@@ -1,64 +1,46 @@
 package cmd
 
 import (
-	"errors"
 	"fmt"
-	"io/fs"
-	"lit/index"
-	"lit/refs"
-	"lit/util"
+	"lit/repo"
 	"os"
 
 	"github.com/spf13/cobra"
 )
 
-// ErrInitFileCreation is returned by InitializeRepo when it cannot create a file.
-var ErrInitFileCreation = errors.New("failed to instantiate required files")
-
-// InitializeRepo initializes a new repo if possible, otherwise returns an error.
-func InitializeRepo() error {
-	err := os.Mkdir(".lit", 0777)
-
-	if errors.Is(err, fs.ErrExist) {
-		return errors.New("already a lit repository")
-	} else if err != nil {
-		return ErrInitFileCreation
-	}
-
-	err = os.Mkdir(".lit/objects", 0777)
-
-	if err != nil {
-		return ErrInitFileCreation
-	}
+var (
+	Init = cobra.Command{
+		Use:   "init",
+		Short: "initialize a repository",
+		Long:  "initializes a repository in the .lit file of the current working directory",
+		Run: func(cmd *cobra.Command, _ []string) {
+			formatName, err := cmd.Flags().GetString("object-format")
 
-	err = os.MkdirAll(".lit/refs/heads", 0777)
+			if err != nil {
+				panic(err)
+			}
 
-	if err != nil {
-		return ErrInitFileCreation
-	}
+			chunkThreshold, err := cmd.Flags().GetInt64("chunk-threshold")
 
-	err = util.WriteJSON(".lit/HEAD", refs.HeadContent{Detached: false, Location: "main"})
+			if err != nil {
+				panic(err)
+			}
 
-	if err != nil {
-		return ErrInitFileCreation
-	}
+			config := repo.Config{ObjectFormat: formatName, ChunkThreshold: chunkThreshold}
 
-	err = index.SetDefault()
+			if dir := os.Getenv(EnvDir); dir != "" {
+				workTree := os.Getenv(EnvWorkTree)
 
-	if err != nil {
-		return ErrInitFileCreation
-	}
+				if workTree == "" {
+					workTree = "."
+				}
 
-	return nil
-}
+				_, err = repo.InitDir(workTree, dir, config)
+			} else {
+				_, err = repo.Init(".", config)
+			}
 
-var (
-	Init = cobra.Command{
-		Use:   "init",
-		Short: "initialize a repository",
-		Long:  "initializes a repository in the .lit file of the current working directory",
-		Run: func(_ *cobra.Command, _ []string) {
-			if err := InitializeRepo(); err != nil {
+			if err != nil {
 				fmt.Println("Could not initialize:", err)
 			} else {
 				fmt.Println("Successfully initialized empty lit repository. Happy coding!")
@@ -70,4 +52,6 @@ var (
 
 func init() {
 	RootCmd.AddCommand(&Init)
+	Init.Flags().String("object-format", repo.DefaultConfig.ObjectFormat, "object format of the repository: lit, or sha1 and sha256 for git-compatible objects")
+	Init.Flags().Int64("chunk-threshold", 0, "store files of at least this many bytes as deduplicated chunks, 0 disables chunking")
 }
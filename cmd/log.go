@@ -4,104 +4,76 @@ import (
 	"errors"
 	"fmt"
 	"lit/objects"
-	"lit/refs"
-	"sort"
+	"lit/repo"
 
 	"github.com/spf13/cobra"
 )
 
-type CommitHashPair struct {
-	Com *objects.Commit
-	Hash string
-}
-
-func recursivelyAddCommitsToSlice(commitHash string, out *[]CommitHashPair) error {
-	commit, err := objects.ReadAsCommit(commitHash)
-
-	if err != nil {
-		return err
-	}
-
-	*out = append(*out, CommitHashPair{commit, commitHash})
-
-	for _, parent := range commit.Parents {
-		err = recursivelyAddCommitsToSlice(parent, out)
-
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-type byTime []CommitHashPair
-
-func (t byTime) Len() int {
-	return len(t)
-}
-
-func (t byTime) Swap(i, j int) {
-	t[i], t[j] = t[j], t[i]
-}
-
-func (t byTime) Less(i, j int) bool {
-	return t[i].Com.Time.After(t[j].Com.Time)
-}
-
 var (
 	Log = cobra.Command{
-		Use:   "log",
+		Use:   "log [revision-range...]",
 		Short: "shows commits",
-		Long:  "shows every commit upstream of the current commit",
-		Run: func(_ *cobra.Command, _ []string) {
-			if !IsRepo() {
-				fmt.Println("Not a repository!")
+		Long:  "shows every commit upstream of the current commit, or the commits of the given revisions and ranges such as main..feature",
+		Run: func(cmd *cobra.Command, args []string) {
+			r := openRepo()
+
+			if r == nil {
 				return
 			}
 
-			commitHash, err := refs.HeadCommit()
+			noAbbrev, err := cmd.Flags().GetBool("no-abbrev")
 
 			if err != nil {
-				if errors.Is(err, refs.ErrNotFound) {
-					fmt.Println("HEAD doesn't point to a commit yet.")
-					return
-				}
+				panic(err)
+			}
 
-				fmt.Println(err)
+			commits, err := r.Log(args...)
+
+			if errors.Is(err, repo.ErrNoCommits) {
+				fmt.Println("HEAD doesn't point to a commit yet.")
 				return
 			}
 
-			commits := []CommitHashPair{}
-
-			err = recursivelyAddCommitsToSlice(commitHash, &commits)
+			if errors.Is(err, repo.ErrBadRevision) {
+				fmt.Println(err)
+				return
+			}
 
 			if errors.Is(err, objects.ErrNotOfType) {
 				fmt.Printf("Error when back-tracking commits: not a commit!\n")
 				return
 			}
-		
+
+			if errors.Is(err, objects.ErrCorruptObject) {
+				fmt.Printf("Error when back-tracking commits: %s\n", err)
+				return
+			}
+
 			if errors.Is(err, objects.ErrCouldNotRead) {
 				fmt.Printf("Error when back-tracking commits: could not read a commit!\n")
 				return
 			}
-		
+
 			if err != nil {
 				fmt.Printf("Unexpected error reading commit: %s\n", err)
 				return
 			}
 
-			sort.Sort(byTime(commits))
+			for _, entry := range commits {
+				hash := entry.Hash
 
-			for _, commitHashPair := range commits {
-				fmt.Println(commitHashPair.Hash, commitHashPair.Com.Name)
-			}
+				if !noAbbrev {
+					hash = abbreviate(r, hash)
+				}
 
+				fmt.Println(hash, entry.Commit.Name)
+			}
 		},
-		Args: cobra.NoArgs,
+		Args: cobra.ArbitraryArgs,
 	}
 )
 
 func init() {
 	RootCmd.AddCommand(&Log)
+	Log.Flags().Bool("no-abbrev", false, "shows full commit hashes instead of the shortest unambiguous prefixes")
 }
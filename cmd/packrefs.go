@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	PackRefs = cobra.Command{
+		Use:   "pack-refs",
+		Short: "packs refs",
+		Long:  "moves every branch and tag into the single packed-refs file, which is faster to read than a file per ref for repositories with many refs",
+		Run: func(_ *cobra.Command, _ []string) {
+			r := openRepo()
+
+			if r == nil {
+				return
+			}
+
+			packed, err := r.PackRefs()
+
+			if err != nil {
+				fmt.Println("Couldn't pack refs:", err)
+				return
+			}
+
+			if packed == 0 {
+				fmt.Println("Nothing to pack.")
+				return
+			}
+
+			fmt.Printf("Packed %d refs.\n", packed)
+		},
+		Args: cobra.NoArgs,
+	}
+)
+
+func init() {
+	RootCmd.AddCommand(&PackRefs)
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	Reflog = cobra.Command{
+		Use:   "reflog [ref]",
+		Short: "shows the history of a ref",
+		Long:  "shows every change of the commit HEAD or the given branch points to, newest first",
+		Run: func(_ *cobra.Command, args []string) {
+			r := openRepo()
+
+			if r == nil {
+				return
+			}
+
+			ref := "HEAD"
+
+			if len(args) > 0 {
+				ref = args[0]
+			}
+
+			entries, err := r.Reflog(ref)
+
+			if err != nil {
+				fmt.Println("Couldn't read the reflog:", err)
+				return
+			}
+
+			for i, entry := range entries {
+				hash := entry.New
+
+				// deletions point to no commit
+				if hash == "" {
+					hash = strings.Repeat("0", len(entry.Old))
+				}
+
+				fmt.Printf("%s %s@{%d}: %s\n", hash, ref, i, entry.Reason)
+			}
+		},
+		Args: cobra.MaximumNArgs(1),
+	}
+)
+
+func init() {
+	RootCmd.AddCommand(&Reflog)
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"lit/objects"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	Repack = cobra.Command{
+		Use:   "repack",
+		Short: "packs objects",
+		Long:  "consolidates loose objects and existing packs into a single pack file, storing similar versions of files as deltas",
+		Run: func(cmd *cobra.Command, _ []string) {
+			r := openRepo()
+
+			if r == nil {
+				return
+			}
+
+			depth, err := cmd.Flags().GetInt("depth")
+
+			if err != nil {
+				panic(err)
+			}
+
+			window, err := cmd.Flags().GetInt("window")
+
+			if err != nil {
+				panic(err)
+			}
+
+			options := objects.DefaultPackOptions
+			options.DeltaDepth = depth
+			options.DeltaWindow = window
+
+			result, err := r.Repack(options)
+
+			if err != nil {
+				fmt.Println("Couldn't repack:", err)
+				return
+			}
+
+			if result.Objects == 0 {
+				fmt.Println("Nothing to repack.")
+				return
+			}
+
+			fmt.Printf("Packed %d objects, %d as deltas (%d loose objects, %d packs merged).\n", result.Objects, result.Deltas, result.LooseRemoved, result.PacksRemoved)
+		},
+		Args: cobra.NoArgs,
+	}
+)
+
+func init() {
+	RootCmd.AddCommand(&Repack)
+	Repack.Flags().Int("depth", objects.DefaultPackOptions.DeltaDepth, "maximum length of delta chains, 0 disables deltas")
+	Repack.Flags().Int("window", objects.DefaultPackOptions.DeltaWindow, "number of other versions of a file tried as delta base")
+}
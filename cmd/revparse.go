@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"lit/repo"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	RevParse = cobra.Command{
+		Use:   "rev-parse <revision>...",
+		Short: "resolves revisions",
+		Long:  "prints the hash of the object each revision resolves to, such as HEAD~2, main^2, main@{1}, HEAD:path/to/file. Ranges like a..b print the included commits followed by the excluded ones prefixed with ^",
+		Run: func(_ *cobra.Command, args []string) {
+			r := openRepo()
+
+			if r == nil {
+				return
+			}
+
+			for _, arg := range args {
+				if repo.IsRevisionRange(arg) {
+					revisions, err := r.ParseRevisionRange(arg)
+
+					if err != nil {
+						fmt.Println(err)
+						return
+					}
+
+					for _, hash := range revisions.Include {
+						fmt.Println(hash)
+					}
+
+					for _, hash := range revisions.Exclude {
+						fmt.Println("^" + hash)
+					}
+
+					continue
+				}
+
+				hash, err := r.ResolveRevision(arg)
+
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+
+				fmt.Println(hash)
+			}
+		},
+		Args: cobra.MinimumNArgs(1),
+	}
+)
+
+func init() {
+	RootCmd.AddCommand(&RevParse)
+}
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"lit/index"
 
 	"github.com/spf13/cobra"
 )
@@ -13,12 +12,13 @@ var (
 		Short: "initialize a repository",
 		Long:  "initializes a repository in the .lit file of the current working directory",
 		Run: func(_ *cobra.Command, _ []string) {
-			if !IsRepo() {
-				fmt.Println("fatal: not a repository!")
+			r := openRepo()
+
+			if r == nil {
 				return
 			}
-			
-			unstagedStatus, stagedStatus, untracked, err := index.GetStatus()
+
+			status, err := r.Status()
 
 			if err != nil {
 				fmt.Println(err)
@@ -26,20 +26,20 @@ var (
 			}
 			fmt.Println("Untracked files:")
 
-			for _, path := range untracked {
-				fmt.Printf("\t%s\n", path)
+			for _, path := range status.Untracked {
+				fmt.Printf("\t%s\n", displayPath(r, path))
 			}
 
 			fmt.Println("Changes not staged for commit:")
-			
-			for path, stat := range unstagedStatus {
-				fmt.Printf("\t%s: %s\n", path, stat)
+
+			for path, stat := range status.Unstaged {
+				fmt.Printf("\t%s: %s\n", displayPath(r, path), stat)
 			}
 
 			fmt.Println("Changes to be committed:")
 
-			for path, stat := range stagedStatus {
-				fmt.Printf("\t%s: %s\n", path, stat)
+			for path, stat := range status.Staged {
+				fmt.Printf("\t%s: %s\n", displayPath(r, path), stat)
 			}
 		},
 		Args: cobra.NoArgs,
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	SymbolicRef = cobra.Command{
+		Use:   "symbolic-ref <name> [<ref>]",
+		Short: "reads and sets symbolic refs",
+		Long:  "prints the ref the symbolic ref <name> points to, such as the branch HEAD points to, or points it to <ref> if given. Names are HEAD, branch names or full ref names such as refs/default",
+		Run: func(cmd *cobra.Command, args []string) {
+			r := openRepo()
+
+			if r == nil {
+				return
+			}
+
+			deleteFlag, err := cmd.Flags().GetBool("delete")
+
+			if err != nil {
+				panic(err)
+			}
+
+			short, err := cmd.Flags().GetBool("short")
+
+			if err != nil {
+				panic(err)
+			}
+
+			reason, err := cmd.Flags().GetString("message")
+
+			if err != nil {
+				panic(err)
+			}
+
+			name := args[0]
+
+			switch {
+			case deleteFlag:
+				err = r.DeleteSymbolicRef(name)
+			case len(args) > 1:
+				if reason == "" {
+					reason = "symbolic-ref: moving to " + args[1]
+				}
+
+				err = r.SetSymbolicRef(name, args[1], reason)
+			default:
+				var target string
+
+				if target, err = r.SymbolicRef(name); err == nil {
+					if short {
+						target = strings.TrimPrefix(strings.TrimPrefix(target, "refs/heads/"), "refs/tags/")
+					}
+
+					fmt.Println(target)
+				}
+			}
+
+			if err != nil {
+				fmt.Println("fatal:", err)
+			}
+		},
+		Args: cobra.RangeArgs(1, 2),
+	}
+)
+
+func init() {
+	RootCmd.AddCommand(&SymbolicRef)
+	SymbolicRef.Flags().BoolP("delete", "d", false, "deletes the symbolic ref, leaving the ref it points to alone")
+	SymbolicRef.Flags().Bool("short", false, "prints the name of the ref without refs/heads/ or refs/tags/")
+	SymbolicRef.Flags().StringP("message", "m", "", "the reason recorded in the reflog of HEAD")
+}
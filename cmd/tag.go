@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"lit/refs"
+	"lit/repo"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func displayTags(r *repo.Repository, pattern string) {
+	tags, err := r.Tags(pattern)
+
+	if err != nil {
+		fmt.Println("Couldn't list tags:", err)
+		return
+	}
+
+	for _, tag := range tags {
+		fmt.Println(tag.Name)
+	}
+}
+
+func showTag(r *repo.Repository, name string) {
+	tag, err := r.Tag(name)
+
+	if errors.Is(err, refs.ErrNotFound) {
+		fmt.Printf("tag %s not found\n", name)
+		return
+	}
+
+	if err != nil {
+		fmt.Println("Couldn't read tag:", err)
+		return
+	}
+
+	if tag.Annotation == nil {
+		fmt.Println("lightweight tag", tag.Name, tag.Hash)
+		return
+	}
+
+	fmt.Println("tag", tag.Name)
+	fmt.Println("Tagger:", tag.Annotation.Tagger)
+	fmt.Println("Date:  ", tag.Annotation.Time.Format(time.RFC1123Z))
+	fmt.Printf("\n%s\n\n", tag.Annotation.Message)
+	fmt.Println(tag.Annotation.TargetType, tag.Annotation.Target)
+}
+
+var (
+	Tag = cobra.Command{
+		Use:   "tag [<name> [<revision>]]",
+		Short: "manipulates tags",
+		Long:  "creates a tag with name <name> pointing to <revision>, or HEAD if omitted, if provided, else lists tags. With -a or -m the tag is annotated: it points to a tag object recording the message, the tagger and the time",
+		Run: func(cmd *cobra.Command, args []string) {
+			r := openRepo()
+
+			if r == nil {
+				return
+			}
+
+			list, err := cmd.Flags().GetBool("list")
+
+			if err != nil {
+				panic(err)
+			}
+
+			if len(args) == 0 || list {
+				pattern := ""
+
+				if len(args) > 0 {
+					pattern = args[0]
+				}
+
+				displayTags(r, pattern)
+				return
+			}
+
+			deleteFlag, err := cmd.Flags().GetBool("delete")
+
+			if err != nil {
+				panic(err)
+			}
+
+			show, err := cmd.Flags().GetBool("show")
+
+			if err != nil {
+				panic(err)
+			}
+
+			annotate, err := cmd.Flags().GetBool("annotate")
+
+			if err != nil {
+				panic(err)
+			}
+
+			message, err := cmd.Flags().GetString("message")
+
+			if err != nil {
+				panic(err)
+			}
+
+			name := args[0]
+
+			if deleteFlag {
+				if err = r.DeleteTag(name); errors.Is(err, refs.ErrNotFound) {
+					fmt.Printf("tag %s not found\n", name)
+				} else if err != nil {
+					fmt.Println(err)
+				}
+
+				return
+			}
+
+			if show {
+				showTag(r, name)
+				return
+			}
+
+			target := "HEAD"
+
+			if len(args) > 1 {
+				target = args[1]
+			}
+
+			annotate = annotate || cmd.Flags().Changed("message")
+
+			if annotate && message == "" {
+				fmt.Println("Annotated tags need a message, given with -m")
+				return
+			}
+
+			if _, err = r.CreateTag(name, target, message, annotate); err != nil {
+				fmt.Println("Couldn't create tag:", err)
+			}
+		},
+		Args: cobra.MaximumNArgs(2),
+	}
+)
+
+func init() {
+	RootCmd.AddCommand(&Tag)
+	Tag.Flags().BoolP("annotate", "a", false, "creates an annotated tag")
+	Tag.Flags().StringP("message", "m", "", "the message of an annotated tag, implies -a")
+	Tag.Flags().BoolP("list", "l", false, "lists the tags matching the glob pattern given instead of <name>")
+	Tag.Flags().BoolP("delete", "d", false, "deletes tag instead of creating it")
+	Tag.Flags().Bool("show", false, "shows the tag and the object it points to")
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"lit/refs"
+	"lit/repo"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// resolveRefValue resolves the new or old value of a ref update, a hash of
+// zeros standing for no ref.
+func resolveRefValue(r *repo.Repository, value string) (string, error) {
+	if strings.Trim(value, "0") == "" {
+		return "", nil
+	}
+
+	return r.ResolveRevision(value)
+}
+
+// parseRefUpdate parses an update given as a command followed by its
+// arguments, as in the lines read by update-ref --stdin:
+//
+//	update <ref> <new> [<old>]
+//	create <ref> <new>
+//	delete <ref> [<old>]
+//	verify <ref> [<old>]
+func parseRefUpdate(r *repo.Repository, fields []string, reason string) (refs.RefUpdate, error) {
+	update := refs.RefUpdate{Reason: reason}
+	arity := map[string][2]int{"update": {2, 3}, "create": {2, 2}, "delete": {1, 2}, "verify": {1, 2}}
+
+	if len(fields) == 0 {
+		return update, errors.New("empty command")
+	}
+
+	limits, known := arity[fields[0]]
+
+	if !known {
+		return update, fmt.Errorf("unknown command %s", fields[0])
+	}
+
+	args := fields[1:]
+
+	if len(args) < limits[0] || len(args) > limits[1] {
+		return update, fmt.Errorf("%s takes %d to %d arguments", fields[0], limits[0], limits[1])
+	}
+
+	update.Ref = refs.FullRefName(args[0])
+	var err error
+
+	switch fields[0] {
+	case "update", "create":
+		if update.New, err = resolveRefValue(r, args[1]); err != nil {
+			return update, err
+		}
+
+		if update.New == "" {
+			return update, fmt.Errorf("%s needs a new value, use delete to delete a ref", fields[0])
+		}
+
+		// create only succeeds for refs that don't exist
+		update.HaveOld = fields[0] == "create" || len(args) > 2
+
+		if len(args) > 2 {
+			update.Old, err = resolveRefValue(r, args[2])
+		}
+	default:
+		update.VerifyOnly = fields[0] == "verify"
+		update.HaveOld = len(args) > 1 || update.VerifyOnly
+
+		if len(args) > 1 {
+			update.Old, err = resolveRefValue(r, args[1])
+		}
+	}
+
+	return update, err
+}
+
+var (
+	UpdateRef = cobra.Command{
+		Use:   "update-ref <ref> <new> [<old>]",
+		Short: "updates refs safely",
+		Long:  "points <ref> to <new>, only if it points to <old> when given, where a hash of zeros stands for no ref. With -d, deletes <ref>. With --stdin, reads update, create, delete and verify commands one per line and applies them all or none",
+		Run: func(cmd *cobra.Command, args []string) {
+			r := openRepo()
+
+			if r == nil {
+				return
+			}
+
+			stdin, err := cmd.Flags().GetBool("stdin")
+
+			if err != nil {
+				panic(err)
+			}
+
+			deleteFlag, err := cmd.Flags().GetBool("delete")
+
+			if err != nil {
+				panic(err)
+			}
+
+			reason, err := cmd.Flags().GetString("message")
+
+			if err != nil {
+				panic(err)
+			}
+
+			updates := []refs.RefUpdate{}
+
+			if stdin {
+				scanner := bufio.NewScanner(os.Stdin)
+
+				for line := 1; scanner.Scan(); line++ {
+					fields := strings.Fields(scanner.Text())
+
+					if len(fields) == 0 {
+						continue
+					}
+
+					update, err := parseRefUpdate(r, fields, reason)
+
+					if err != nil {
+						fmt.Printf("fatal: line %d: %s\n", line, err)
+						return
+					}
+
+					updates = append(updates, update)
+				}
+
+				if err = scanner.Err(); err != nil {
+					fmt.Println("fatal:", err)
+					return
+				}
+			} else {
+				command := "update"
+
+				if deleteFlag {
+					command = "delete"
+				}
+
+				update, err := parseRefUpdate(r, append([]string{command}, args...), reason)
+
+				if err != nil {
+					fmt.Println("fatal:", err)
+					return
+				}
+
+				updates = append(updates, update)
+			}
+
+			if err = r.UpdateRefs(updates...); err != nil {
+				fmt.Println("fatal:", err)
+			}
+		},
+		Args: cobra.MaximumNArgs(3),
+	}
+)
+
+func init() {
+	RootCmd.AddCommand(&UpdateRef)
+	UpdateRef.Flags().Bool("stdin", false, "reads updates from standard input, applying all of them or none")
+	UpdateRef.Flags().BoolP("delete", "d", false, "deletes the ref instead of updating it")
+	UpdateRef.Flags().StringP("message", "m", "update-ref", "the reason recorded in the reflog")
+}
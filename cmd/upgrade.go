@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	Upgrade = cobra.Command{
+		Use:   "upgrade",
+		Short: "upgrades the repository format",
+		Long:  "migrates a repository created by an older version of lit to the current repository format in place; an interrupted upgrade can be resumed by running it again",
+		Run: func(_ *cobra.Command, _ []string) {
+			r := openRepo()
+
+			if r == nil {
+				return
+			}
+
+			result, err := r.Upgrade()
+
+			if err != nil {
+				fmt.Println("Couldn't upgrade:", err)
+				return
+			}
+
+			if result.From == result.To {
+				fmt.Printf("Repository format version %d is up to date.\n", result.To)
+				return
+			}
+
+			fmt.Printf("Upgraded repository format version %d to %d, converting %d objects.\n", result.From, result.To, result.Converted)
+
+			if len(result.Corrupt) > 0 {
+				fmt.Printf("Left %d corrupt objects unconverted:\n", len(result.Corrupt))
+
+				for _, hash := range result.Corrupt {
+					fmt.Println("\t" + hash)
+				}
+			}
+		},
+		Args: cobra.NoArgs,
+	}
+)
+
+func init() {
+	RootCmd.AddCommand(&Upgrade)
+}
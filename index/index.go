@@ -10,6 +10,7 @@ package index
 
 import (
 	"errors"
+	"fmt"
 	"io/fs"
 	"lit/objects"
 	"lit/refs"
@@ -23,15 +24,64 @@ import (
 	"time"
 )
 
+// Index manipulates the index file of a single repository together with the
+// working tree it describes. Paths stored in the index are slash-separated and
+// relative to the working tree.
+type Index struct {
+	path     string
+	workTree string
+	objects  objects.ObjectStore
+	refs     *refs.Store
+
+	chunkThreshold int64
+}
+
+// New returns an Index stored at path, describing the files under workTree.
+func New(path string, workTree string, objectStore objects.ObjectStore, refStore *refs.Store) *Index {
+	return &Index{path: path, workTree: workTree, objects: objectStore, refs: refStore}
+}
+
+// SetChunkThreshold makes files of at least threshold bytes be staged as
+// chunked blobs. A threshold of zero disables chunking.
+func (ix *Index) SetChunkThreshold(threshold int64) {
+	ix.chunkThreshold = threshold
+}
+
+// workTreePath converts a path relative to the working tree into a filesystem path.
+func (ix *Index) workTreePath(path string) string {
+	return filepath.Join(ix.workTree, filepath.FromSlash(path))
+}
+
+// lock locks the index file, failing with util.ErrLocked if another process
+// is updating it. The index must be locked while it is read to be modified.
+func (ix *Index) lock() (*util.Lock, error) {
+	return util.LockFile(ix.path)
+}
+
+// Lock locks the index for an operation spanning the index and the working
+// tree, such as a checkout, failing with util.ErrLocked if another process is
+// updating it.
+func (ix *Index) Lock() (*util.Lock, error) {
+	return ix.lock()
+}
+
 // SetDefault initializes the index to its default state containing no
 // paths pointing to blob hashes.
-func SetDefault() error {
-	return util.WriteJSON(".lit/index", map[string]string{})
+func (ix *Index) SetDefault() error {
+	return ix.SetStaged(map[string]string{})
 }
 
 // StagePairs adds pairs to the index.
-func StagePairs(pairs map[string]string) error {
-	staged, err := Staged()
+func (ix *Index) StagePairs(pairs map[string]string) error {
+	lock, err := ix.lock()
+
+	if err != nil {
+		return err
+	}
+
+	defer lock.Unlock()
+
+	staged, err := ix.Staged()
 
 	if err != nil {
 		return err
@@ -41,24 +91,31 @@ func StagePairs(pairs map[string]string) error {
 		staged[path] = blobHash
 	}
 
-	return SetStaged(staged)
+	return ix.writeStaged(staged)
 }
 
 // SetStaged overrides the content of the index to the specified pairs.
-func SetStaged(pairs map[string]string) error {
-	err := util.WriteJSON(".lit/index", pairs)
+func (ix *Index) SetStaged(pairs map[string]string) error {
+	lock, err := ix.lock()
 
 	if err != nil {
 		return err
 	}
 
-	return nil
+	defer lock.Unlock()
+
+	return ix.writeStaged(pairs)
+}
+
+// writeStaged overrides the content of the index, which must be locked.
+func (ix *Index) writeStaged(pairs map[string]string) error {
+	return util.WriteJSON(ix.path, pairs)
 }
 
 // Staged returns the contents of the index
-func Staged() (map[string]string, error) {
+func (ix *Index) Staged() (map[string]string, error) {
 	result := map[string]string{}
-	err := util.ReadJSON(".lit/index", &result)
+	err := util.ReadJSON(ix.path, &result)
 
 	return result, err
 }
@@ -66,7 +123,7 @@ func Staged() (map[string]string, error) {
 // satisfyUnstagedChanges modifies the staged map so that no more unstaged
 // changes of filepaths that pass the predicate are reported to
 // be changes in the future.
-func satisfyUnstagedChanges(predicate func(string) bool, unstagedChanges map[string]Status, staged map[string]string) error {
+func (ix *Index) satisfyUnstagedChanges(predicate func(string) bool, unstagedChanges map[string]Status, staged map[string]string) error {
 	for filepathChanged, state := range unstagedChanges {
 		if !predicate(filepathChanged) {
 			continue
@@ -74,7 +131,7 @@ func satisfyUnstagedChanges(predicate func(string) bool, unstagedChanges map[str
 
 		switch state {
 		case Modified:
-			hash := objects.Blobify(filepathChanged)
+			hash := objects.Blobify(ix.objects, ix.workTreePath(filepathChanged), ix.chunkThreshold)
 
 			if hash == "" {
 				return errors.New("couldn't write files to objects")
@@ -93,10 +150,10 @@ func satisfyUnstagedChanges(predicate func(string) bool, unstagedChanges map[str
 }
 
 // satisfyUntracked blobifies untracked files that pass the predicate.
-func satisfyUntracked(predicate func(string) bool, untracked []string, staged map[string]string) error {
+func (ix *Index) satisfyUntracked(predicate func(string) bool, untracked []string, staged map[string]string) error {
 	for _, untrackedPath := range untracked {
 		if predicate(untrackedPath) {
-			hash := objects.Blobify(untrackedPath)
+			hash := objects.Blobify(ix.objects, ix.workTreePath(untrackedPath), ix.chunkThreshold)
 
 			if hash == "" {
 				return errors.New("couldn't write files to objects")
@@ -111,9 +168,17 @@ func satisfyUntracked(predicate func(string) bool, untracked []string, staged ma
 
 // Stage blobifies and adds the given file at the path to the index.
 // If the path points to a directory, Stage recursively applies
-// the process to sub-files.
-func Stage(path string) error {
-	staged, err := Staged()
+// the process to sub-files. The path is relative to the working tree.
+func (ix *Index) Stage(path string) error {
+	lock, err := ix.lock()
+
+	if err != nil {
+		return err
+	}
+
+	defer lock.Unlock()
+
+	staged, err := ix.Staged()
 
 	if err != nil {
 		return err
@@ -122,7 +187,7 @@ func Stage(path string) error {
 	// we keep track if any changes were made to the index, reporting an error if none were made
 	changesDone := false
 
-	unstagedChanges, untracked, err := UnstagedChanges(staged)
+	unstagedChanges, untracked, err := ix.UnstagedChanges(staged)
 
 	if err != nil {
 		return err
@@ -138,11 +203,11 @@ func Stage(path string) error {
 		}
 	}
 
-	if err = satisfyUnstagedChanges(predicate, unstagedChanges, staged); err != nil {
+	if err = ix.satisfyUnstagedChanges(predicate, unstagedChanges, staged); err != nil {
 		return err
 	}
 
-	if err = satisfyUntracked(predicate, untracked, staged); err != nil {
+	if err = ix.satisfyUntracked(predicate, untracked, staged); err != nil {
 		return err
 	}
 
@@ -150,7 +215,7 @@ func Stage(path string) error {
 		return errors.New("file does not exist")
 	}
 
-	if err = SetStaged(staged); err != nil {
+	if err = ix.writeStaged(staged); err != nil {
 		return err
 	}
 
@@ -203,9 +268,14 @@ func generateTreeNode(hashes map[string]string) treeNode {
 
 		if dir != "" {
 			for _, subdir := range strings.Split(dir, "/") {
-				newTreeN := newTreeNode()
-				currentTree.subtrees[subdir] = newTreeN
-				currentTree = newTreeN
+				subtree, exists := currentTree.subtrees[subdir]
+
+				if !exists {
+					subtree = newTreeNode()
+					currentTree.subtrees[subdir] = subtree
+				}
+
+				currentTree = subtree
 			}
 		}
 
@@ -216,35 +286,51 @@ func generateTreeNode(hashes map[string]string) treeNode {
 }
 
 // Write writes the treeNode into lit/objects, returning the hash of the upmost-level tree.
-func (tn treeNode) Write() string {
+func (tn treeNode) Write(store objects.ObjectStore) (string, error) {
 	hashes := map[string]objects.TreeEntry{}
 
 	for name, sub := range tn.subtrees {
-		hashes[name] = objects.TreeEntry{ObjType: "Tree", Hash: sub.Write()}
+		hash, err := sub.Write(store)
+
+		if err != nil {
+			return "", fmt.Errorf("%s/%w", name, err)
+		}
+
+		hashes[name] = objects.TreeEntry{ObjType: "Tree", Hash: hash}
 	}
 
 	for name, blobHash := range tn.blobs {
 		hashes[name] = objects.TreeEntry{ObjType: "Blob", Hash: blobHash}
 	}
 
-	return objects.WriteTree(hashes)
+	return objects.WriteTree(store, hashes)
 }
 
-// Commit creates a commit with the given name.
-func Commit(commitName string) (string, error) {
-	hashes, err := Staged()
+// Commit creates a commit with the given name and author. The index is locked
+// while committing, and the tree and commit objects are written to disk before
+// HEAD or its branch is moved to the commit.
+func (ix *Index) Commit(commitName string, author string) (string, error) {
+	lock, err := ix.lock()
 
 	if err != nil {
 		return "", err
 	}
 
-	tree := generateTreeNode(hashes).Write()
+	defer lock.Unlock()
 
-	if tree == "" {
-		return "", errors.New("failed to write commit")
+	hashes, err := ix.Staged()
+
+	if err != nil {
+		return "", err
 	}
 
-	prevHead, err := refs.HeadCommit()
+	tree, err := generateTreeNode(hashes).Write(ix.objects)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to write commit: %w", err)
+	}
+
+	prevHead, err := ix.refs.HeadCommit()
 
 	if err != nil {
 		if errors.Is(err, refs.ErrNotFound) {
@@ -255,14 +341,25 @@ func Commit(commitName string) (string, error) {
 	}
 
 	commitStruct := objects.NewCommit(commitName, tree, time.Now())
-	commitStruct.Parents = []string{prevHead}
-	com := objects.WriteCommit(commitStruct)
+	commitStruct.Author = author
+
+	// root commits, such as the first commit of an orphan branch, have no parents
+	if prevHead != "" {
+		commitStruct.Parents = []string{prevHead}
+	}
+	com := objects.WriteCommit(ix.objects, commitStruct)
 
 	if com == "" {
 		return "", errors.New("failed to write commit")
 	}
 
-	err = refs.NudgeHead(com)
+	reason := "commit: " + commitName
+
+	if prevHead == "" {
+		reason = "commit (initial): " + commitName
+	}
+
+	err = ix.refs.NudgeHead(com, reason)
 
 	if err != nil {
 		return "", err
@@ -271,36 +368,54 @@ func Commit(commitName string) (string, error) {
 	return com, nil
 }
 
-// UnstagedChanges returns a map of unstaged changes and a slice of untracked files.
-func UnstagedChanges(staged map[string]string) (map[string]Status, []string, error) {
-	staged = copyMap(staged)
+// walkWorkTree calls f for every file and directory of the working tree
+// with its slash-separated path relative to the working tree, skipping the
+// lit directory. Returning filepath.SkipDir from f skips a directory.
+func (ix *Index) walkWorkTree(f func(string, fs.DirEntry) error) error {
+	return filepath.WalkDir(ix.workTree, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
 
-	untracked := []string{}
-	unstagedResult := map[string]Status{}
+		relative, err := filepath.Rel(ix.workTree, path)
 
-	err := filepath.WalkDir(".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		cleanPath := util.CleanPath(path)
+		cleanPath := util.CleanPath(relative)
+
+		if cleanPath == "." {
+			return nil
+		}
 
-		if cleanPath == ".lit" {
+		// the lit directory holds the index and may have been moved into the working tree under another name
+		if cleanPath == ".lit" || path == filepath.Dir(ix.path) {
 			return filepath.SkipDir
 		}
 
-		if cleanPath == "." || d.IsDir() {
+		return f(cleanPath, d)
+	})
+}
+
+// UnstagedChanges returns a map of unstaged changes and a slice of untracked files.
+func (ix *Index) UnstagedChanges(staged map[string]string) (map[string]Status, []string, error) {
+	staged = copyMap(staged)
+
+	untracked := []string{}
+	unstagedResult := map[string]Status{}
+
+	err := ix.walkWorkTree(func(cleanPath string, d fs.DirEntry) error {
+		if d.IsDir() {
 			return nil
 		}
 
-		data, err := os.ReadFile(cleanPath)
+		hash, err := objects.HashFile(ix.objects.Format(), ix.workTreePath(cleanPath), ix.chunkThreshold)
 
 		if err != nil {
 			return err
 		}
 
-		hash := objects.Hash(data)
-
 		indexHash, exists := staged[cleanPath]
 
 		if !exists {
@@ -332,8 +447,8 @@ func UnstagedChanges(staged map[string]string) (map[string]Status, []string, err
 
 // recursivelyGetHashes recursively gets hashes and inserts them into the
 // result map with the given basePath.
-func recursivelyGetHashes(hash string, result map[string]string, basePath string) error {
-	tree, err := objects.ReadAsTree(hash)
+func recursivelyGetHashes(store objects.ObjectStore, hash string, result map[string]string, basePath string) error {
+	tree, err := objects.ReadAsTree(store, hash)
 
 	if err != nil {
 		return err
@@ -341,7 +456,7 @@ func recursivelyGetHashes(hash string, result map[string]string, basePath string
 
 	for name, entry := range tree {
 		if entry.ObjType == "Tree" {
-			if err = recursivelyGetHashes(entry.Hash, result, basePath+name+"/"); err != nil {
+			if err = recursivelyGetHashes(store, entry.Hash, result, basePath+name+"/"); err != nil {
 				return err
 			}
 		} else {
@@ -353,12 +468,12 @@ func recursivelyGetHashes(hash string, result map[string]string, basePath string
 }
 
 // StagedChanges returns a map of changes to files compared to the previous commit.
-func StagedChanges(hashes map[string]string) (map[string]Status, error) {
+func (ix *Index) StagedChanges(hashes map[string]string) (map[string]Status, error) {
 	hashes = copyMap(hashes)
 
 	stagedStatus := map[string]Status{}
 
-	headCommit, err := refs.HeadCommit()
+	headCommit, err := ix.refs.HeadCommit()
 
 	if err != nil {
 		if errors.Is(err, refs.ErrNotFound) {
@@ -372,14 +487,14 @@ func StagedChanges(hashes map[string]string) (map[string]Status, error) {
 		return nil, err
 	}
 
-	com, err := objects.ReadAsCommit(headCommit)
+	com, err := objects.ReadAsCommit(ix.objects, headCommit)
 
 	if err != nil {
 		return nil, err
 	}
 
 	commitHashes := map[string]string{}
-	recursivelyGetHashes(com.CommitTree, commitHashes, "")
+	recursivelyGetHashes(ix.objects, com.CommitTree, commitHashes, "")
 
 	for name, commitHash := range commitHashes {
 		indexHash, exists := hashes[name]
@@ -417,21 +532,21 @@ func copyMap(original map[string]string) map[string]string {
 
 // GetStatus compares the contents of the index, working-tree and previous commit
 // to produce a list of changes to files
-func GetStatus() (map[string]Status, map[string]Status, []string, error) {
+func (ix *Index) GetStatus() (map[string]Status, map[string]Status, []string, error) {
 
-	hashes, err := Staged()
+	hashes, err := ix.Staged()
 
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
-	unstagedStatus, untracked, err := UnstagedChanges(hashes)
+	unstagedStatus, untracked, err := ix.UnstagedChanges(hashes)
 
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
-	stagedStatus, err := StagedChanges(hashes)
+	stagedStatus, err := ix.StagedChanges(hashes)
 
 	if err != nil {
 		return nil, nil, nil, err
@@ -441,24 +556,10 @@ func GetStatus() (map[string]Status, map[string]Status, []string, error) {
 }
 
 // ClearWorkingTree clears the working tree leaving certain files untouched.
-func ClearWorkingTree(leaveAlone set.Set[string]) error {
-	err := filepath.WalkDir(".", func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-
-		cleanPath := util.CleanPath(path)
-
-		if cleanPath == "." {
-			return nil
-		}
-
-		if cleanPath == ".lit" {
-			return filepath.SkipDir
-		}
-
-		if _, exists := leaveAlone[path]; !exists {
-			err = os.RemoveAll(path)
+func (ix *Index) ClearWorkingTree(leaveAlone set.Set[string]) error {
+	err := ix.walkWorkTree(func(cleanPath string, d fs.DirEntry) error {
+		if _, exists := leaveAlone[cleanPath]; !exists {
+			err := os.RemoveAll(ix.workTreePath(cleanPath))
 
 			if err != nil {
 				return err
@@ -479,34 +580,28 @@ func ClearWorkingTree(leaveAlone set.Set[string]) error {
 	return nil
 }
 
-// LoadIn loads in a commit.
-func LoadIn(com *objects.Commit) error {
-	tree, err := objects.ReadAsTree(com.CommitTree)
+// LoadIn loads in a commit, returning the paths of the files written to the working tree.
+func (ix *Index) LoadIn(com *objects.Commit) ([]string, error) {
+	tree, err := objects.ReadAsTree(ix.objects, com.CommitTree)
 
 	if err != nil {
-		return err
-	}
-
-	err = objects.LoadTree("", tree)
-
-	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return objects.LoadTree(ix.objects, ix.workTree, tree)
 }
 
 // recursivelyAddToIndex recursively adds elements of the tree into the index map.
-func recursivelyAddToIndex(tree map[string]objects.TreeEntry, index map[string]string, basePath string) error {
+func recursivelyAddToIndex(store objects.ObjectStore, tree map[string]objects.TreeEntry, index map[string]string, basePath string) error {
 	for name, entry := range tree {
 		if entry.ObjType == "Tree" {
-			subTree, err := objects.ReadAsTree(entry.Hash)
+			subTree, err := objects.ReadAsTree(store, entry.Hash)
 
 			if err != nil {
 				return err
 			}
 
-			err = recursivelyAddToIndex(subTree, index, basePath+name+"/")
+			err = recursivelyAddToIndex(store, subTree, index, basePath+name+"/")
 
 			if err != nil {
 				return err
@@ -521,8 +616,10 @@ func recursivelyAddToIndex(tree map[string]objects.TreeEntry, index map[string]s
 	return nil
 }
 
-func LoadIntoIndex(stagedChanges map[string]Status, hashes map[string]string, commit *objects.Commit) error {
-	tree, err := objects.ReadAsTree(commit.CommitTree)
+// LoadIntoIndex sets the index to the tree of commit, keeping the given staged
+// changes. The caller must hold the lock of the index, see Lock.
+func (ix *Index) LoadIntoIndex(stagedChanges map[string]Status, hashes map[string]string, commit *objects.Commit) error {
+	tree, err := objects.ReadAsTree(ix.objects, commit.CommitTree)
 
 	if err != nil {
 		return err
@@ -534,11 +631,11 @@ func LoadIntoIndex(stagedChanges map[string]Status, hashes map[string]string, co
 		result[path] = hashes[path]
 	}
 
-	err = recursivelyAddToIndex(tree, result, "")
+	err = recursivelyAddToIndex(ix.objects, tree, result, "")
 
 	if err != nil {
 		return err
 	}
 
-	return SetStaged(result)
+	return ix.writeStaged(result)
 }
@@ -0,0 +1,151 @@
+package objects
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// MinAbbrevLength is the length of the shortest hash prefix ResolveHashPrefix accepts.
+	MinAbbrevLength = 4
+	// DefaultAbbrevLength is the length hashes are abbreviated to for display
+	// unless a longer prefix is needed to tell them apart.
+	DefaultAbbrevLength = 7
+)
+
+var (
+	// ErrUnknownHash is returned by ResolveHashPrefix when no object starts with the prefix.
+	ErrUnknownHash = errors.New("no object with that hash")
+	// ErrHashTooShort is returned by ResolveHashPrefix for prefixes shorter than MinAbbrevLength.
+	ErrHashTooShort = fmt.Errorf("hash prefixes need at least %d characters", MinAbbrevLength)
+	// ErrAmbiguousHash is matched by errors.Is for every *AmbiguousHashError.
+	ErrAmbiguousHash = errors.New("ambiguous hash prefix")
+)
+
+// HashCandidate is an object whose hash starts with an ambiguous prefix.
+type HashCandidate struct {
+	Hash string
+	// Type is the type of the object, empty if it cannot be read.
+	Type string
+}
+
+// AmbiguousHashError is returned by ResolveHashPrefix when several objects
+// start with the prefix.
+type AmbiguousHashError struct {
+	Prefix     string
+	Candidates []HashCandidate
+}
+
+func (e *AmbiguousHashError) Error() string {
+	var message strings.Builder
+
+	fmt.Fprintf(&message, "%v %s, candidates are:", ErrAmbiguousHash, e.Prefix)
+
+	for _, candidate := range e.Candidates {
+		objType := candidate.Type
+
+		if objType == "" {
+			objType = "unreadable object"
+		}
+
+		fmt.Fprintf(&message, "\n  %s %s", candidate.Hash, objType)
+	}
+
+	return message.String()
+}
+
+func (e *AmbiguousHashError) Is(target error) bool {
+	return target == ErrAmbiguousHash
+}
+
+// isHex reports whether s only consists of lowercase hexadecimal digits.
+func isHex(s string) bool {
+	return strings.Trim(s, "0123456789abcdef") == ""
+}
+
+// ResolveHashPrefix returns the hash of the only object of any type in the
+// store starting with prefix, which is case-insensitive and at least
+// MinAbbrevLength characters long. Prefixes shared by several objects fail
+// with an *AmbiguousHashError listing them.
+func ResolveHashPrefix(store ObjectStore, prefix string) (string, error) {
+	prefix = strings.ToLower(prefix)
+
+	if !isHex(prefix) {
+		return "", ErrInvalidHash
+	}
+
+	if len(prefix) < MinAbbrevLength {
+		return "", ErrHashTooShort
+	}
+
+	candidates, err := store.ResolvePrefix(prefix)
+
+	if err != nil {
+		return "", err
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", ErrUnknownHash
+	case 1:
+		return candidates[0], nil
+	}
+
+	sort.Strings(candidates)
+	ambiguous := &AmbiguousHashError{Prefix: prefix}
+
+	for _, hash := range candidates {
+		// the types are only informative, so unreadable objects are listed as well
+		objType, _ := ReadType(store, hash)
+		ambiguous.Candidates = append(ambiguous.Candidates, HashCandidate{hash, objType})
+	}
+
+	return "", ambiguous
+}
+
+// Abbreviate returns the shortest prefix of hash, at least minLength
+// characters long, that no other object in the store starts with, so that
+// ResolveHashPrefix resolves it back to hash. The whole hash is returned if
+// the objects cannot be listed.
+func Abbreviate(store ObjectStore, hash string, minLength int) string {
+	if minLength < MinAbbrevLength {
+		minLength = MinAbbrevLength
+	}
+
+	if len(hash) <= minLength {
+		return hash
+	}
+
+	candidates, err := store.ResolvePrefix(hash[:minLength])
+
+	if err != nil {
+		return hash
+	}
+
+	length := minLength
+
+	for _, other := range candidates {
+		if other == hash {
+			continue
+		}
+
+		// one more character than shared with the other object tells them apart
+		shared := 0
+
+		for shared < len(hash) && shared < len(other) && hash[shared] == other[shared] {
+			shared++
+		}
+
+		if shared+1 > length {
+			length = shared + 1
+		}
+	}
+
+	if length > len(hash) {
+		return hash
+	}
+
+	return hash[:length]
+}
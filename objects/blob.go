@@ -2,9 +2,7 @@ package objects
 
 import (
 	"crypto/sha256"
-	"encoding/json"
 	"fmt"
-	"lit/util"
 	"os"
 )
 
@@ -24,75 +22,61 @@ func Hash(data []byte) string {
 	return fmt.Sprintf("%2x", sha256.Sum256(data))
 }
 
-func BlobToJSON(data []byte) []byte {
-	data, err := json.MarshalIndent(map[string]any{
-		"Type": "Blob",
-		"Object": struct {
-			Content string
-		}{string(data)},
-	}, "", "\t")
+// Blobify writes the file at path as a blob without holding it in memory,
+// returning its hash or an empty string on failure. Files of at least
+// chunkThreshold bytes are written as chunked blobs, unless chunkThreshold is zero.
+func Blobify(store ObjectStore, path string, chunkThreshold int64) string {
+	file, err := os.Open(path)
 
 	if err != nil {
-		panic(err)
+		return ""
 	}
 
-	return data
-}
+	defer file.Close()
 
-func Blobify(path string) string {
-	data, err := os.ReadFile(path)
+	info, err := file.Stat()
 
 	if err != nil {
 		return ""
 	}
 
-	hash := WriteBlob(data)
-
-	return hash
-}
-
-func GetHashPath(hash string) string {
-	return ".lit/objects/" + hash[:FolderCharacters] + "/" + hash[FolderCharacters:]
-}
-
-func WriteBlob(data []byte) (hash string) {
-	hash = Hash(data)
-
-	jsonBlob := BlobToJSON(data)
-
-	err := os.MkdirAll(".lit/objects/"+hash[:FolderCharacters], 0777)
-
-	if err != nil {
-		hash = ""
-		return
+	if shouldChunk(info.Size(), chunkThreshold) {
+		return WriteChunkedBlob(store, file)
 	}
 
-	err = os.WriteFile(GetHashPath(hash), jsonBlob, 0777)
+	hash, err := WriteBlobFrom(store, file, info.Size())
 
 	if err != nil {
-		hash = ""
+		return ""
 	}
 
-	return
+	return hash
 }
 
-type genericObject struct {
-	ObjType string         `json:"Type"`
-	Obj     map[string]any `json:"Object"`
+// shouldChunk reports whether content of the given size is written as a chunked blob.
+func shouldChunk(size int64, chunkThreshold int64) bool {
+	return chunkThreshold > 0 && size >= chunkThreshold
 }
 
-func ReadAsBlob(hash string) (string, error) {
-	objectData := genericObject{}
+func WriteBlob(store ObjectStore, data []byte) (hash string) {
+	return writeObject(store, store.Format().HashObject(TypeBlob, data), TypeBlob, data)
+}
 
-	err := util.ReadJSON(GetHashPath(hash), &objectData)
+// ReadAsBlob returns the content of the blob with the given hash,
+// reassembling chunked blobs.
+func ReadAsBlob(store ObjectStore, hash string) ([]byte, error) {
+	objType, body, err := readAnyObject(store, hash)
 
 	if err != nil {
-		return "", ErrCouldNotRead
+		return nil, err
 	}
 
-	if objectData.ObjType != "Blob" {
-		return "", ErrNotOfType
+	switch objType {
+	case TypeBlob:
+		return body, nil
+	case TypeChunked:
+		return reassemble(store, hash, body)
+	default:
+		return nil, ErrNotOfType
 	}
-
-	return objectData.Obj["Content"].(string), nil
 }
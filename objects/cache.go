@@ -0,0 +1,153 @@
+package objects
+
+import (
+	"container/list"
+	"reflect"
+	"sync"
+)
+
+// DefaultCacheSize is the number of decoded objects DefaultCache holds.
+const DefaultCacheSize = 4096
+
+// DefaultCache caches the trees and commits decoded by ReadAsTree and
+// ReadAsCommit, so walking the history reads and parses each object once.
+var DefaultCache = NewCache(DefaultCacheSize)
+
+// CacheStats holds the counters of a Cache.
+type CacheStats struct {
+	Hits, Misses, Evictions uint64
+	// Len is the number of objects currently cached.
+	Len int
+}
+
+// Cache is a bounded least recently used cache of decoded objects, keyed by
+// the store they were read from and their hash. It is safe for concurrent use.
+type Cache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[cacheKey]*list.Element
+	// order holds the cached entries, most recently used first
+	order *list.List
+	stats CacheStats
+}
+
+type cacheKey struct {
+	store ObjectStore
+	hash  string
+}
+
+type cacheEntry struct {
+	key   cacheKey
+	value any
+}
+
+// NewCache returns an empty Cache holding at most capacity objects. A
+// capacity of zero disables caching.
+func NewCache(capacity int) *Cache {
+	return &Cache{capacity: capacity, entries: map[cacheKey]*list.Element{}, order: list.New()}
+}
+
+// cacheable reports whether objects read from store can be cached, which
+// requires the store to be usable as a map key.
+func cacheable(store ObjectStore) bool {
+	return reflect.TypeOf(store).Comparable()
+}
+
+// get returns the cached object with the given hash read from store.
+func (c *Cache) get(store ObjectStore, hash string) (any, bool) {
+	if !cacheable(store) {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, found := c.entries[cacheKey{store, hash}]
+
+	if !found {
+		c.stats.Misses++
+		return nil, false
+	}
+
+	c.stats.Hits++
+	c.order.MoveToFront(element)
+
+	return element.Value.(*cacheEntry).value, true
+}
+
+// add caches the object with the given hash read from store, evicting the
+// least recently used objects beyond the capacity.
+func (c *Cache) add(store ObjectStore, hash string, value any) {
+	if !cacheable(store) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := cacheKey{store, hash}
+
+	if element, found := c.entries[key]; found {
+		element.Value.(*cacheEntry).value = value
+		c.order.MoveToFront(element)
+
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key, value})
+	c.evict()
+}
+
+// evict removes the least recently used objects until the cache fits its capacity.
+func (c *Cache) evict() {
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+		c.stats.Evictions++
+	}
+}
+
+// SetCapacity changes the number of objects the cache holds, evicting
+// objects if it shrinks.
+func (c *Cache) SetCapacity(capacity int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.capacity = capacity
+	c.evict()
+}
+
+// remove removes the objects with the given hashes read from any store, as
+// they may no longer exist after being pruned.
+func (c *Cache) remove(hashes map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, element := range c.entries {
+		if hashes[key.hash] {
+			c.order.Remove(element)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Clear removes every cached object.
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = map[cacheKey]*list.Element{}
+	c.order.Init()
+}
+
+// Stats returns the current counters of the cache.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Len = c.order.Len()
+
+	return stats
+}
@@ -0,0 +1,268 @@
+package objects
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// TypeChunked is the type of chunk manifests, which store a large blob as a
+// list of smaller blobs. Manifests are read transparently by ReadAsBlob.
+const TypeChunked = "chunked"
+
+// Sizes of the chunks the content-defined chunker produces. Chunk boundaries
+// depend only on the content around them, so inserting or changing bytes
+// only changes the chunks around the modification.
+const (
+	MinChunkSize     = 128 << 10
+	AverageChunkSize = 1 << chunkBits
+	MaxChunkSize     = 2 << 20
+
+	chunkBits = 19
+)
+
+// gearTable maps bytes to the pseudo-random values the rolling gear hash of
+// the chunker is built from. It is generated deterministically, as changing
+// it would move every chunk boundary.
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+
+	state := uint64(0x6c6974) // splitmix64
+
+	for i := range table {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+
+	return table
+}()
+
+// chunkMask selects the high bits of the gear hash which have to be zero at a
+// chunk boundary, occurring on average every AverageChunkSize bytes.
+const chunkMask = uint64(AverageChunkSize-1) << (64 - chunkBits)
+
+// Chunker splits the content of a reader into content-defined chunks.
+type Chunker struct {
+	reader io.Reader
+	buffer []byte
+	eof    bool
+}
+
+// NewChunker returns a Chunker reading from reader.
+func NewChunker(reader io.Reader) *Chunker {
+	return &Chunker{reader: reader, buffer: make([]byte, 0, MaxChunkSize)}
+}
+
+// Next returns the next chunk, or io.EOF once the content is exhausted. The
+// returned slice is only valid until the next call.
+func (c *Chunker) Next() ([]byte, error) {
+	// keep the buffer filled with a whole maximum sized chunk
+	for !c.eof && len(c.buffer) < MaxChunkSize {
+		n, err := c.reader.Read(c.buffer[len(c.buffer):MaxChunkSize])
+		c.buffer = c.buffer[:len(c.buffer)+n]
+
+		if err == io.EOF {
+			c.eof = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(c.buffer) == 0 {
+		return nil, io.EOF
+	}
+
+	cut := cutPoint(c.buffer)
+	chunk := append([]byte(nil), c.buffer[:cut]...)
+	c.buffer = c.buffer[:copy(c.buffer, c.buffer[cut:])]
+
+	return chunk, nil
+}
+
+// cutPoint returns the length of the chunk at the start of data.
+func cutPoint(data []byte) int {
+	if len(data) <= MinChunkSize {
+		return len(data)
+	}
+
+	var hash uint64
+
+	for i := MinChunkSize; i < len(data); i++ {
+		hash = (hash << 1) + gearTable[data[i]]
+
+		if hash&chunkMask == 0 {
+			return i + 1
+		}
+	}
+
+	return len(data)
+}
+
+// ChunkRef is a chunk listed in a manifest.
+type ChunkRef struct {
+	Hash string
+	Size int64
+}
+
+// encodeManifest serializes the chunks of a manifest, one "<hash> <size>" line per chunk.
+func encodeManifest(chunks []ChunkRef) []byte {
+	var body bytes.Buffer
+
+	for _, chunk := range chunks {
+		body.WriteString(chunk.Hash + " " + strconv.FormatInt(chunk.Size, 10) + "\n")
+	}
+
+	return body.Bytes()
+}
+
+// decodeManifest parses the body of a manifest.
+func decodeManifest(body []byte) ([]ChunkRef, error) {
+	chunks := []ChunkRef{}
+
+	for _, line := range strings.SplitAfter(string(body), "\n") {
+		if line == "" {
+			continue
+		}
+
+		hash, size, found := strings.Cut(strings.TrimSuffix(line, "\n"), " ")
+		parsedSize, err := strconv.ParseInt(size, 10, 64)
+
+		if !found || err != nil {
+			return nil, ErrMalformedObject
+		}
+
+		chunks = append(chunks, ChunkRef{hash, parsedSize})
+	}
+
+	return chunks, nil
+}
+
+// ErrChunkingUnsupported is returned when chunking is requested for an object
+// format that cannot represent chunk manifests.
+var ErrChunkingUnsupported = errors.New("the object format does not support chunked blobs")
+
+// SupportsChunking reports whether blobs of the given format can be chunked.
+// git has no equivalent of chunk manifests, so only the lit format supports them.
+func SupportsChunking(format Format) bool {
+	return format == FormatLit
+}
+
+// chunkContent splits the content of reader into chunks, calling f with the
+// hash and data of each chunk, and returns the manifest listing them.
+func chunkContent(format Format, reader io.Reader, f func(hash string, chunk []byte) error) ([]byte, error) {
+	chunker := NewChunker(reader)
+	chunks := []ChunkRef{}
+
+	for {
+		chunk, err := chunker.Next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		hash := format.HashObject(TypeBlob, chunk)
+
+		if err = f(hash, chunk); err != nil {
+			return nil, err
+		}
+
+		chunks = append(chunks, ChunkRef{hash, int64(len(chunk))})
+	}
+
+	return encodeManifest(chunks), nil
+}
+
+// WriteChunkedBlob writes the content of reader as a chunk manifest and its
+// chunks, returning the hash of the manifest or an empty string on failure.
+func WriteChunkedBlob(store ObjectStore, reader io.Reader) string {
+	format := store.Format()
+
+	if !SupportsChunking(format) {
+		return ""
+	}
+
+	manifest, err := chunkContent(format, reader, func(hash string, chunk []byte) error {
+		if exists, err := store.Has(hash); err != nil || exists {
+			return err
+		}
+
+		if writeObject(store, hash, TypeBlob, chunk) == "" {
+			return ErrCouldNotRead
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return ""
+	}
+
+	return writeObject(store, format.HashObject(TypeChunked, manifest), TypeChunked, manifest)
+}
+
+// HashChunkedBlob returns the hash WriteChunkedBlob gives the content of
+// reader, without writing anything.
+func HashChunkedBlob(format Format, reader io.Reader) (string, error) {
+	manifest, err := chunkContent(format, reader, func(string, []byte) error {
+		return nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return format.HashObject(TypeChunked, manifest), nil
+}
+
+// ReadChunks returns the chunks listed in the manifest with the given hash.
+func ReadChunks(store ObjectStore, hash string) ([]ChunkRef, error) {
+	body, err := readObject(store, hash, TypeChunked)
+
+	if err != nil {
+		return nil, err
+	}
+
+	chunks, err := decodeManifest(body)
+
+	if err != nil {
+		return nil, &CorruptObjectError{Hash: hash}
+	}
+
+	return chunks, nil
+}
+
+// reassemble concatenates the chunks listed in a manifest body.
+func reassemble(store ObjectStore, hash string, manifest []byte) ([]byte, error) {
+	chunks, err := decodeManifest(manifest)
+
+	if err != nil {
+		return nil, &CorruptObjectError{Hash: hash}
+	}
+
+	var content bytes.Buffer
+
+	for _, chunk := range chunks {
+		data, err := readObject(store, chunk.Hash, TypeBlob)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if int64(len(data)) != chunk.Size {
+			return nil, &CorruptObjectError{Hash: hash}
+		}
+
+		content.Write(data)
+	}
+
+	return content.Bytes(), nil
+}
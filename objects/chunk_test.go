@@ -0,0 +1,148 @@
+package objects
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// chunks returns the chunks the chunker splits data into.
+func chunks(t *testing.T, data []byte) [][]byte {
+	result := [][]byte{}
+	chunker := NewChunker(bytes.NewReader(data))
+
+	for {
+		chunk, err := chunker.Next()
+
+		if err == io.EOF {
+			return result
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result = append(result, chunk)
+	}
+}
+
+func TestChunkSizes(t *testing.T) {
+	data := randomBytes(7, 8*AverageChunkSize)
+	split := chunks(t, data)
+
+	if !bytes.Equal(bytes.Join(split, nil), data) {
+		t.Fatal("the chunks do not add up to the content")
+	}
+
+	for i, chunk := range split {
+		last := i == len(split)-1
+
+		if len(chunk) > MaxChunkSize || len(chunk) < MinChunkSize && !last {
+			t.Errorf("chunk %d of %d takes %d bytes", i, len(split), len(chunk))
+		}
+	}
+
+	if len(split) < 4 {
+		t.Errorf("split %d bytes into only %d chunks", len(data), len(split))
+	}
+}
+
+func TestChunkBoundariesAreStable(t *testing.T) {
+	original := randomBytes(8, 16*AverageChunkSize)
+	edited := append([]byte(nil), original...)
+	edited[len(edited)/2] ^= 0xff
+
+	known := map[string]bool{}
+
+	for _, chunk := range chunks(t, original) {
+		known[string(chunk)] = true
+	}
+
+	changed := 0
+	split := chunks(t, edited)
+
+	for _, chunk := range split {
+		if !known[string(chunk)] {
+			changed++
+		}
+	}
+
+	// the edited chunk, and the one after it if the edit moved its boundary
+	if changed == 0 || changed > 2 {
+		t.Errorf("a 1-byte edit changed %d of %d chunks", changed, len(split))
+	}
+}
+
+func TestChunkedBlobRoundTrip(t *testing.T) {
+	const threshold = 1 << 20
+
+	cases := []struct {
+		name    string
+		size    int
+		chunked bool
+	}{
+		{"empty", 0, false},
+		{"small", 1000, false},
+		{"below threshold", threshold - 1, false},
+		{"at threshold", threshold, true},
+		{"several chunks", 6 * AverageChunkSize, true},
+	}
+
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			store := NewMemoryStore(FormatLit)
+			content := randomBytes(int64(10+i), c.size)
+			path := filepath.Join(t.TempDir(), "file")
+
+			if err := os.WriteFile(path, content, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			hash := Blobify(store, path, threshold)
+
+			if hash == "" {
+				t.Fatal("could not write the blob")
+			}
+
+			if expected, err := HashFile(FormatLit, path, threshold); err != nil || expected != hash {
+				t.Errorf("HashFile gives %s, %v but the written blob is %s", expected, err, hash)
+			}
+
+			objType, err := ReadType(store, hash)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if chunked := objType == TypeChunked; chunked != c.chunked {
+				t.Errorf("blob of %d bytes is written as %s", c.size, objType)
+			}
+
+			if data, err := ReadAsBlob(store, hash); err != nil || !bytes.Equal(data, content) {
+				t.Errorf("ReadAsBlob gives %d bytes differing from the content (%v)", len(data), err)
+			}
+
+			blob, err := OpenBlob(store, hash)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer blob.Close()
+
+			if data, err := io.ReadAll(blob); err != nil || !bytes.Equal(data, content) {
+				t.Errorf("OpenBlob reads %d bytes differing from the content (%v)", len(data), err)
+			}
+		})
+	}
+}
+
+func TestChunkingUnsupportedByGitFormats(t *testing.T) {
+	store := NewMemoryStore(FormatSHA1)
+
+	if hash := WriteChunkedBlob(store, bytes.NewReader(randomBytes(9, 1000))); hash != "" {
+		t.Errorf("wrote chunked blob %s in the sha1 format", hash)
+	}
+}
@@ -1,18 +1,13 @@
 package objects
 
-import (
-	"crypto/sha256"
-	"encoding/json"
-	"fmt"
-	"lit/util"
-	"os"
-	"time"
-)
+import "time"
 
 type Commit struct {
 	Name, CommitTree string
 	Parents          []string
 	Time             time.Time
+	// Author is the identity of the commit's author in "Name <email>" form.
+	Author string
 }
 
 func (*Commit) ObjectType() string {
@@ -20,85 +15,50 @@ func (*Commit) ObjectType() string {
 }
 
 func NewCommit(name, commitTree string, time time.Time) *Commit {
-	return &Commit{name, commitTree, []string{}, time}
+	return &Commit{name, commitTree, []string{}, time, ""}
 }
 
-func HashIsCommit(hash string) bool {
-	_, err := ReadAsCommit(hash)
+func HashIsCommit(store ObjectStore, hash string) bool {
+	_, err := ReadAsCommit(store, hash)
 
 	return err == nil
 }
 
-func HashCommit(commit *Commit) string {
-	hash := sha256.Sum256([]byte(fmt.Sprintf("%v", commit)))
+func WriteCommit(store ObjectStore, commit *Commit) (hash string) {
+	format := store.Format()
+	body := format.EncodeCommit(commit)
 
-	return fmt.Sprintf("%2x", hash)
+	return writeObject(store, format.HashObject(TypeCommit, body), TypeCommit, body)
 }
 
-func CommitToJSON(commit *Commit) []byte {
-	data, err := json.MarshalIndent(map[string]any{
-		"Type": "Commit",
-		"Object": struct {
-			Com Commit `json:"Commit"`
-		}{*commit},
-	}, "", "\t")
-
-	if err != nil {
-		panic(err)
-	}
-
-	return data
-}
-
-func WriteCommit(commit *Commit) (hash string) {
-	hash = HashCommit(commit)
-
-	jsonCommit := CommitToJSON(commit)
-
-	err := os.MkdirAll(".lit/objects/"+hash[:FolderCharacters], 0777)
-
-	if err != nil {
-		hash = ""
-		return
+func ReadAsCommit(store ObjectStore, hash string) (*Commit, error) {
+	if cached, found := DefaultCache.get(store, hash); found {
+		if c, isCommit := cached.(*Commit); isCommit {
+			return copyCommit(c), nil
+		}
 	}
 
-	err = os.WriteFile(GetHashPath(hash), jsonCommit, 0777)
+	body, err := readObject(store, hash, TypeCommit)
 
 	if err != nil {
-		hash = ""
+		return nil, err
 	}
 
-	return
-}
-
-func ReadAsCommit(hash string) (*Commit, error) {
-	objectData := genericObject{}
-
-	err := util.ReadJSON(GetHashPath(hash), &objectData)
+	c, err := store.Format().DecodeCommit(body)
 
 	if err != nil {
 		return nil, ErrCouldNotRead
 	}
 
-	if objectData.ObjType != "Commit" {
-		return nil, ErrNotOfType
-	}
-
-	commitStructure := objectData.Obj["Commit"].(map[string]any)
-
-	resultTime := time.Time{}
-
-	err = json.Unmarshal([]byte(`"`+commitStructure["Time"].(string)+`"`), &resultTime)
-
-	if err != nil {
-		panic(err)
-	}
+	DefaultCache.add(store, hash, copyCommit(c))
 
-	c := NewCommit(commitStructure["Name"].(string), commitStructure["CommitTree"].(string), resultTime)
+	return c, nil
+}
 
-	for _, parent := range commitStructure["Parents"].([]any) {
-		c.Parents = append(c.Parents, parent.(string))
-	}
+// copyCommit returns a copy of c, so cached commits are not modified by callers.
+func copyCommit(c *Commit) *Commit {
+	result := *c
+	result.Parents = append([]string{}, c.Parents...)
 
-	return c, nil
+	return &result
 }
@@ -0,0 +1,176 @@
+package objects
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+/*
+A delta describes how to build a target from a base as a sequence of
+instructions, preceded by the sizes of both:
+
+	base size uvarint | target size uvarint | instructions
+
+Two kinds of instructions exist:
+
+	deltaCopy   | offset uvarint | length uvarint  copies bytes of the base
+	deltaInsert | length uvarint | data            inserts literal data
+*/
+
+const (
+	deltaCopy   byte = 1
+	deltaInsert byte = 2
+)
+
+// deltaBlockSize is the size of the base blocks matches are searched for with.
+const deltaBlockSize = 16
+
+// ErrMalformedDelta is returned when a delta cannot be applied to its base.
+var ErrMalformedDelta = errors.New("malformed delta")
+
+// computeDelta returns a delta building target from base.
+func computeDelta(base []byte, target []byte) []byte {
+	var delta bytes.Buffer
+
+	writeUvarint(&delta, uint64(len(base)))
+	writeUvarint(&delta, uint64(len(target)))
+
+	// index the base by the content of its aligned blocks
+	blocks := map[string]int{}
+
+	for offset := 0; offset+deltaBlockSize <= len(base); offset += deltaBlockSize {
+		block := string(base[offset : offset+deltaBlockSize])
+
+		if _, exists := blocks[block]; !exists {
+			blocks[block] = offset
+		}
+	}
+
+	insertStart := 0
+	position := 0
+
+	for position+deltaBlockSize <= len(target) {
+		baseOffset, found := blocks[string(target[position:position+deltaBlockSize])]
+
+		if !found {
+			position++
+			continue
+		}
+
+		// extend the match backwards into pending literal data and forwards as far as possible
+		start := position
+
+		for start > insertStart && baseOffset > 0 && base[baseOffset-1] == target[start-1] {
+			start--
+			baseOffset--
+		}
+
+		end := position + deltaBlockSize
+		baseEnd := baseOffset + (end - start)
+
+		for end < len(target) && baseEnd < len(base) && base[baseEnd] == target[end] {
+			end++
+			baseEnd++
+		}
+
+		writeInsert(&delta, target[insertStart:start])
+
+		delta.WriteByte(deltaCopy)
+		writeUvarint(&delta, uint64(baseOffset))
+		writeUvarint(&delta, uint64(end-start))
+
+		position = end
+		insertStart = end
+	}
+
+	writeInsert(&delta, target[insertStart:])
+
+	return delta.Bytes()
+}
+
+// writeInsert writes an insert instruction for data, unless data is empty.
+func writeInsert(delta *bytes.Buffer, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	delta.WriteByte(deltaInsert)
+	writeUvarint(delta, uint64(len(data)))
+	delta.Write(data)
+}
+
+func writeUvarint(buffer *bytes.Buffer, value uint64) {
+	encoded := make([]byte, binary.MaxVarintLen64)
+	buffer.Write(encoded[:binary.PutUvarint(encoded, value)])
+}
+
+// applyDelta builds the target described by delta from base.
+func applyDelta(base []byte, delta []byte) ([]byte, error) {
+	reader := bytes.NewReader(delta)
+
+	baseSize, err := binary.ReadUvarint(reader)
+
+	if err != nil || baseSize != uint64(len(base)) {
+		return nil, ErrMalformedDelta
+	}
+
+	targetSize, err := binary.ReadUvarint(reader)
+
+	// no byte of the instructions builds more than the whole base plus one
+	// byte of the target, bounding the size of any target the delta can build
+	maxTarget := uint64(reader.Len()) * (uint64(len(base)) + 1)
+
+	if err != nil || targetSize > maxTarget {
+		return nil, ErrMalformedDelta
+	}
+
+	// the target grows as instructions are applied rather than trusting its size
+	target := make([]byte, 0, minUint64(targetSize, uint64(len(base)+len(delta))))
+
+	for reader.Len() > 0 {
+		instruction, _ := reader.ReadByte()
+
+		switch instruction {
+		case deltaCopy:
+			offset, errOffset := binary.ReadUvarint(reader)
+			length, errLength := binary.ReadUvarint(reader)
+
+			if errOffset != nil || errLength != nil || offset+length > uint64(len(base)) {
+				return nil, ErrMalformedDelta
+			}
+
+			target = append(target, base[offset:offset+length]...)
+		case deltaInsert:
+			length, err := binary.ReadUvarint(reader)
+
+			if err != nil || length > uint64(reader.Len()) {
+				return nil, ErrMalformedDelta
+			}
+
+			data := make([]byte, length)
+			reader.Read(data)
+			target = append(target, data...)
+		default:
+			return nil, ErrMalformedDelta
+		}
+
+		if uint64(len(target)) > targetSize {
+			return nil, ErrMalformedDelta
+		}
+	}
+
+	if uint64(len(target)) != targetSize {
+		return nil, ErrMalformedDelta
+	}
+
+	return target, nil
+}
+
+func minUint64(a uint64, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+
+	return b
+}
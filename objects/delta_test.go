@@ -0,0 +1,232 @@
+package objects
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"runtime"
+	"testing"
+)
+
+// randomBytes returns n pseudo-random bytes, the same for every run.
+func randomBytes(seed int64, n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+
+	return data
+}
+
+func TestDeltaRoundTrip(t *testing.T) {
+	text := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 100)
+	random := randomBytes(1, 10000)
+
+	edited := append([]byte(nil), random...)
+	copy(edited[5000:], "an edit in the middle")
+
+	cases := []struct {
+		name         string
+		base, target []byte
+	}{
+		{"empty", nil, nil},
+		{"empty base", nil, []byte("new content")},
+		{"empty target", text, nil},
+		{"identical", text, text},
+		{"appended", text, append(append([]byte(nil), text...), "more lines\n"...)},
+		{"prepended", text, append([]byte("a first line\n"), text...)},
+		{"edited", random, edited},
+		{"truncated", random, random[:3333]},
+		{"repeated base", random[:100], bytes.Repeat(random[:100], 50)},
+		{"unrelated", random, randomBytes(2, 5000)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			delta := computeDelta(c.base, c.target)
+			result, err := applyDelta(c.base, delta)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(result, c.target) {
+				t.Errorf("applying the delta built %d bytes differing from the %d bytes of the target", len(result), len(c.target))
+			}
+		})
+	}
+}
+
+func TestDeltaSmallerForSimilarContent(t *testing.T) {
+	base := randomBytes(3, 10000)
+	target := append(append([]byte(nil), base[:6000]...), base[6100:]...)
+
+	if delta := computeDelta(base, target); len(delta) > 100 {
+		t.Errorf("delta between similar blobs takes %d bytes", len(delta))
+	}
+}
+
+func TestApplyMalformedDelta(t *testing.T) {
+	base := []byte("0123456789")
+
+	var huge bytes.Buffer
+	writeUvarint(&huge, uint64(len(base)))
+	writeUvarint(&huge, 1<<62)
+
+	var outOfRange bytes.Buffer
+	writeUvarint(&outOfRange, uint64(len(base)))
+	writeUvarint(&outOfRange, 5)
+	outOfRange.WriteByte(deltaCopy)
+	writeUvarint(&outOfRange, 8)
+	writeUvarint(&outOfRange, 5)
+
+	valid := computeDelta(base, []byte("0123456789abc"))
+
+	cases := map[string][]byte{
+		"empty":             nil,
+		"wrong base size":   computeDelta([]byte("012345678"), []byte("abc")),
+		"huge target size":  huge.Bytes(),
+		"copy out of range": outOfRange.Bytes(),
+		"truncated":         valid[:len(valid)-1],
+		"trailing data":     append(append([]byte(nil), valid...), deltaInsert, 1, 'x'),
+		"unknown op":        append(append([]byte(nil), valid...), 7),
+	}
+
+	for name, delta := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := applyDelta(base, delta); !errors.Is(err, ErrMalformedDelta) {
+				t.Errorf("got error %v, want ErrMalformedDelta", err)
+			}
+		})
+	}
+}
+
+func TestPackRoundTripWithDeltas(t *testing.T) {
+	store := NewMemoryStore(FormatLit)
+	content := randomBytes(4, 20000)
+	hashes := []string{}
+
+	// versions of the same file, so later ones are stored as deltas
+	for i := 0; i < 5; i++ {
+		copy(content[i*1000:], fmt.Sprintf("version %d", i))
+
+		blob := WriteBlob(store, content)
+		tree, err := WriteTree(store, map[string]TreeEntry{"file": {ObjType: "Blob", Hash: blob}})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		hashes = append(hashes, blob, tree)
+	}
+
+	path, deltas, err := WritePack(t.TempDir(), store, hashes, DefaultPackOptions)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if deltas == 0 {
+		t.Error("no blob was stored as a delta")
+	}
+
+	pack, err := OpenPack(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pack.Len() != len(hashes) {
+		t.Errorf("pack holds %d objects, want %d", pack.Len(), len(hashes))
+	}
+
+	for _, hash := range hashes {
+		expected, _ := store.Get(hash)
+		data, err := pack.Get(hash)
+
+		if err != nil {
+			t.Fatalf("reading %s: %v", hash, err)
+		}
+
+		_, expectedBody, _ := DecodeObject(expected)
+		_, body, err := DecodeObject(data)
+
+		if err != nil || !bytes.Equal(body, expectedBody) {
+			t.Errorf("object %s read from the pack differs from the stored one (delta: %v)", hash, pack.IsDelta(hash))
+		}
+	}
+}
+
+func TestRepackStreamsLargeBlobs(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir(), FormatLit)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const size = 8 << 20
+
+	large, err := WriteBlobFrom(store, io.LimitReader(rand.New(rand.NewSource(5)), size), size)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// two versions of a small file, so deltas are still planned for them
+	small := randomBytes(6, 4000)
+	first := WriteBlob(store, small)
+	copy(small[2000:], "edited")
+	second := WriteBlob(store, small)
+
+	for _, blob := range []string{first, second} {
+		entries := map[string]TreeEntry{"large": {ObjType: "Blob", Hash: large}, "small": {ObjType: "Blob", Hash: blob}}
+
+		if _, err := WriteTree(store, entries); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	options := DefaultPackOptions
+	options.DeltaMaxSize = 1 << 20
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	result, err := store.Repack(options)
+
+	runtime.ReadMemStats(&after)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// neither the stored nor the raw form of the large blob may be read into memory
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > size/4 {
+		t.Errorf("repacking allocated %d bytes for a blob of %d bytes", allocated, size)
+	}
+
+	if result.Objects != 5 || result.Deltas != 1 {
+		t.Errorf("packed %d objects with %d deltas, want 5 with 1", result.Objects, result.Deltas)
+	}
+
+	blob, err := OpenBlob(store, large)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer blob.Close()
+
+	content, err := io.ReadAll(blob)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := make([]byte, size)
+	rand.New(rand.NewSource(5)).Read(expected)
+
+	if !bytes.Equal(content, expected) {
+		t.Error("the large blob read from the pack differs from the written one")
+	}
+}
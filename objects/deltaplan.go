@@ -0,0 +1,175 @@
+package objects
+
+import (
+	"bufio"
+	"compress/zlib"
+	"sort"
+	"strconv"
+)
+
+// plannedDelta is a blob chosen to be stored as a delta when writing a pack.
+type plannedDelta struct {
+	base string
+	// data is the compressed delta
+	data []byte
+}
+
+// deltaCandidate is a blob considered for delta compression.
+type deltaCandidate struct {
+	hash string
+	// name is a file name the blob appears under, used to find other versions of the same file
+	name string
+	size int64
+	// stored is the length of the compressed data of the blob
+	stored int64
+}
+
+// blobNames maps the hashes of the given objects that are blobs to a file
+// name they appear under in any of the given trees. Only the headers of the
+// other objects are read, so large blobs are never decompressed.
+func blobNames(store ObjectStore, hashes []string) map[string]string {
+	names := map[string]string{}
+
+	for _, hash := range hashes {
+		if objType, err := ReadType(store, hash); err != nil || objType != TypeTree {
+			continue
+		}
+
+		tree, err := ReadAsTree(store, hash)
+
+		if err != nil {
+			continue
+		}
+
+		for name, entry := range tree {
+			if entry.ObjType == "Blob" {
+				names[entry.Hash] = name
+			}
+		}
+	}
+
+	return names
+}
+
+// storedSizes returns the length of the stored data of the object with the
+// given hash and the size of its raw form, by only decompressing its header.
+// Objects stored as JSON by older lit versions have no raw form, which is
+// reported as a size of -1.
+func storedSizes(store ObjectStore, hash string) (stored int64, raw int64, err error) {
+	reader, stored, err := openSized(store, hash)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer reader.Close()
+
+	buffered := bufio.NewReader(reader)
+
+	if first, err := buffered.Peek(1); err == nil && first[0] == '{' {
+		return stored, -1, nil
+	}
+
+	decompressor, err := zlib.NewReader(buffered)
+
+	if err != nil {
+		return 0, 0, ErrMalformedObject
+	}
+
+	defer decompressor.Close()
+
+	objType, size, err := readHeader(bufio.NewReader(decompressor))
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return stored, int64(len(objType)+len(strconv.FormatInt(size, 10))+2) + size, nil
+}
+
+// planDeltas chooses which blobs to store as deltas against which other
+// blobs. Blobs are grouped by file name and sorted from largest to smallest,
+// so each blob is compared with the previous versions of the same file in a
+// sliding window, only keeping the content of the window in memory. Blobs
+// larger than options.DeltaMaxSize are left out, to be streamed whole.
+func planDeltas(store ObjectStore, hashes []string, options PackOptions) (map[string]plannedDelta, error) {
+	candidates := []deltaCandidate{}
+
+	for hash, name := range blobNames(store, hashes) {
+		stored, size, err := storedSizes(store, hash)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// blobs stored as JSON by older lit versions have no raw form to delta against
+		if size < 0 || size > options.DeltaMaxSize {
+			continue
+		}
+
+		candidates = append(candidates, deltaCandidate{hash, name, size, stored})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].name != candidates[j].name {
+			return candidates[i].name < candidates[j].name
+		}
+
+		if candidates[i].size != candidates[j].size {
+			return candidates[i].size > candidates[j].size
+		}
+
+		return candidates[i].hash < candidates[j].hash
+	})
+
+	deltas := map[string]plannedDelta{}
+	depths := map[string]int{}
+	window := map[string][]byte{}
+
+	for i, target := range candidates {
+		if i > options.DeltaWindow {
+			delete(window, candidates[i-options.DeltaWindow-1].hash)
+		}
+
+		data, err := store.Get(target.hash)
+
+		if err != nil {
+			return nil, err
+		}
+
+		raw, err := decompress(data)
+
+		if err != nil {
+			return nil, err
+		}
+
+		window[target.hash] = raw
+
+		var best plannedDelta
+
+		// only worth it if the delta is smaller than the compressed object
+		bestSize := int(target.stored)
+
+		for j := i - 1; j >= 0 && j >= i-options.DeltaWindow; j-- {
+			base := candidates[j]
+
+			if base.name != target.name || depths[base.hash] >= options.DeltaDepth {
+				continue
+			}
+
+			delta := compress(computeDelta(window[base.hash], raw))
+
+			if len(delta)+len(base.hash)/2 < bestSize {
+				best = plannedDelta{base.hash, delta}
+				bestSize = len(delta) + len(base.hash)/2
+			}
+		}
+
+		if best.base != "" {
+			deltas[target.hash] = best
+			depths[target.hash] = depths[best.base] + 1
+		}
+	}
+
+	return deltas, nil
+}
@@ -0,0 +1,306 @@
+package objects
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DiskStore is the ObjectStore of a repository on disk. New objects are
+// written as loose objects, while reads look at the loose objects as well as
+// the packs in the pack subdirectory.
+type DiskStore struct {
+	Loose *LooseStore
+
+	dir   string
+	mu    sync.RWMutex
+	packs []*Pack
+}
+
+// NewDiskStore returns a DiskStore for the objects directory dir holding
+// objects of the given format.
+func NewDiskStore(dir string, format Format) (*DiskStore, error) {
+	s := &DiskStore{Loose: NewLooseStore(dir, format), dir: dir}
+
+	if err := s.loadPacks(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// PackDir returns the directory packs are kept in.
+func (s *DiskStore) PackDir() string {
+	return filepath.Join(s.dir, "pack")
+}
+
+// loadPacks opens every pack of the pack directory.
+func (s *DiskStore) loadPacks() error {
+	paths, err := filepath.Glob(filepath.Join(s.PackDir(), "pack-*.pack"))
+
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(paths)
+
+	packs := make([]*Pack, 0, len(paths))
+
+	for _, path := range paths {
+		pack, err := OpenPack(path)
+
+		// a pack is only usable once its index has been written
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		packs = append(packs, pack)
+	}
+
+	s.mu.Lock()
+	s.packs = packs
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Packs returns the packs of the store.
+func (s *DiskStore) Packs() []*Pack {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]*Pack(nil), s.packs...)
+}
+
+func (s *DiskStore) Format() Format {
+	return s.Loose.Format()
+}
+
+func (s *DiskStore) Put(hash string, data []byte) error {
+	return s.Loose.Put(hash, data)
+}
+
+func (s *DiskStore) Get(hash string) ([]byte, error) {
+	data, err := s.Loose.Get(hash)
+
+	if !errors.Is(err, ErrObjectNotFound) {
+		return data, err
+	}
+
+	for _, pack := range s.Packs() {
+		data, err = pack.Get(hash)
+
+		if !errors.Is(err, ErrObjectNotFound) {
+			return data, err
+		}
+	}
+
+	return nil, ErrObjectNotFound
+}
+
+func (s *DiskStore) NewWriter() (ObjectWriter, error) {
+	return s.Loose.NewWriter()
+}
+
+func (s *DiskStore) Open(hash string) (io.ReadCloser, error) {
+	reader, err := s.Loose.Open(hash)
+
+	if !errors.Is(err, ErrObjectNotFound) {
+		return reader, err
+	}
+
+	for _, pack := range s.Packs() {
+		reader, err = pack.Open(hash)
+
+		if !errors.Is(err, ErrObjectNotFound) {
+			return reader, err
+		}
+	}
+
+	return nil, ErrObjectNotFound
+}
+
+func (s *DiskStore) Has(hash string) (bool, error) {
+	for _, pack := range s.Packs() {
+		if pack.Has(hash) {
+			return true, nil
+		}
+	}
+
+	return s.Loose.Has(hash)
+}
+
+func (s *DiskStore) Iterate(f func(hash string) error) error {
+	seen := map[string]bool{}
+
+	err := s.Loose.Iterate(func(hash string) error {
+		seen[hash] = true
+
+		return f(hash)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, pack := range s.Packs() {
+		for _, hash := range pack.Hashes() {
+			if seen[hash] {
+				continue
+			}
+
+			seen[hash] = true
+
+			if err = f(hash); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *DiskStore) ResolvePrefix(prefix string) ([]string, error) {
+	prefix = strings.ToLower(prefix)
+
+	result, err := s.Loose.ResolvePrefix(prefix)
+
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+
+	for _, hash := range result {
+		seen[hash] = true
+	}
+
+	for _, pack := range s.Packs() {
+		for _, hash := range pack.ResolvePrefix(prefix) {
+			if !seen[hash] {
+				seen[hash] = true
+				result = append(result, hash)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// RepackResult describes the outcome of DiskStore.Repack.
+type RepackResult struct {
+	// Objects is the number of objects in the new pack.
+	Objects int
+	// LooseRemoved is the number of loose objects moved into the pack.
+	LooseRemoved int
+	// PacksRemoved is the number of packs merged into the new pack.
+	PacksRemoved int
+	// Deltas is the number of objects stored as deltas in the new pack.
+	Deltas int
+}
+
+// Repack consolidates every loose object and every existing pack into a
+// single new pack, then removes the loose objects and old packs.
+func (s *DiskStore) Repack(options PackOptions) (RepackResult, error) {
+	result := RepackResult{}
+	hashes := []string{}
+	loose := []string{}
+
+	err := s.Loose.Iterate(func(hash string) error {
+		loose = append(loose, hash)
+		return nil
+	})
+
+	if err != nil {
+		return result, err
+	}
+
+	err = s.Iterate(func(hash string) error {
+		hashes = append(hashes, hash)
+		return nil
+	})
+
+	if err != nil {
+		return result, err
+	}
+
+	oldPacks := s.Packs()
+
+	if len(hashes) == 0 {
+		return result, nil
+	}
+
+	path, deltas, err := WritePack(s.PackDir(), s, hashes, options)
+
+	if err != nil {
+		return result, err
+	}
+
+	result.Objects = len(hashes)
+	result.Deltas = deltas
+
+	// only remove data once the new pack is complete
+	for _, pack := range oldPacks {
+		if pack.Path == path {
+			continue
+		}
+
+		if err = removePack(pack.Path); err != nil {
+			return result, err
+		}
+
+		result.PacksRemoved++
+	}
+
+	for _, hash := range loose {
+		path, err := s.Loose.HashPath(hash)
+
+		if err != nil {
+			return result, err
+		}
+
+		if err = os.Remove(path); err != nil {
+			return result, err
+		}
+
+		result.LooseRemoved++
+	}
+
+	removeEmptyFolders(s.dir)
+
+	return result, s.loadPacks()
+}
+
+// removePack removes the pack at path together with its index.
+func removePack(path string) error {
+	if err := os.Remove(strings.TrimSuffix(path, ".pack") + ".idx"); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// removeEmptyFolders removes the empty loose object folders of the objects directory dir.
+func removeEmptyFolders(dir string) {
+	folders, err := os.ReadDir(dir)
+
+	if err != nil {
+		return
+	}
+
+	for _, folder := range folders {
+		if folder.IsDir() && len(folder.Name()) == FolderCharacters {
+			// fails for folders that are not empty, which are left alone
+			os.Remove(filepath.Join(dir, folder.Name()))
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package objects
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Object types as written in the header of encoded objects.
+const (
+	TypeBlob   = "blob"
+	TypeTree   = "tree"
+	TypeCommit = "commit"
+	TypeTag    = "tag"
+)
+
+// ErrMalformedObject is returned when stored object data cannot be decoded.
+var ErrMalformedObject = errors.New("malformed object")
+
+// EncodeObject encodes the body of an object of the given type into the form
+// it is stored in: a "<type> <length>\x00" header followed by the raw body,
+// compressed with zlib.
+func EncodeObject(objType string, body []byte) []byte {
+	return compress(append([]byte(objType+" "+strconv.Itoa(len(body))+"\x00"), body...))
+}
+
+// compress compresses raw object data into the form it is stored in.
+func compress(raw []byte) []byte {
+	var buffer bytes.Buffer
+
+	writer := zlib.NewWriter(&buffer)
+	writer.Write(raw)
+
+	if err := writer.Close(); err != nil {
+		panic(err) // writing to a bytes.Buffer cannot fail
+	}
+
+	return buffer.Bytes()
+}
+
+// decompress reverses compress.
+func decompress(data []byte) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, ErrMalformedObject
+	}
+
+	defer reader.Close()
+
+	raw, err := io.ReadAll(reader)
+
+	if err != nil {
+		return nil, ErrMalformedObject
+	}
+
+	return raw, nil
+}
+
+// DecodeObject decodes stored object data into the object's type and body.
+// Objects stored as JSON documents by older versions of lit are decoded as well.
+func DecodeObject(data []byte) (string, []byte, error) {
+	if len(data) > 0 && data[0] == '{' {
+		return decodeLegacyObject(data)
+	}
+
+	raw, err := decompress(data)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	return splitHeader(raw)
+}
+
+// splitHeader splits uncompressed object data into the type from its header and its body.
+func splitHeader(raw []byte) (string, []byte, error) {
+	headerEnd := bytes.IndexByte(raw, 0)
+
+	if headerEnd < 0 {
+		return "", nil, ErrMalformedObject
+	}
+
+	objType, length, found := strings.Cut(string(raw[:headerEnd]), " ")
+
+	if !found {
+		return "", nil, ErrMalformedObject
+	}
+
+	body := raw[headerEnd+1:]
+
+	if size, err := strconv.Atoi(length); err != nil || size != len(body) {
+		return "", nil, ErrMalformedObject
+	}
+
+	return objType, body, nil
+}
+
+// legacyObject is the JSON document objects were stored as before the
+// compressed encoding was introduced.
+type legacyObject struct {
+	Type   string
+	Object map[string]json.RawMessage
+}
+
+// decodeLegacyObject converts a JSON object into its type and the body it
+// would have in the compressed encoding.
+func decodeLegacyObject(data []byte) (string, []byte, error) {
+	var legacy legacyObject
+
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return "", nil, ErrMalformedObject
+	}
+
+	switch legacy.Type {
+	case "Blob":
+		var content string
+
+		if err := json.Unmarshal(legacy.Object["Content"], &content); err != nil {
+			return "", nil, ErrMalformedObject
+		}
+
+		return TypeBlob, []byte(content), nil
+	case "Tree":
+		return TypeTree, legacy.Object["Entries"], nil
+	case "Commit":
+		return TypeCommit, legacy.Object["Commit"], nil
+	default:
+		return "", nil, ErrMalformedObject
+	}
+}
+
+// ConvertLegacyObject stores the object with the given hash again in the
+// current encoding if it is stored as a JSON document, reporting whether it
+// was. Its hash and body are unchanged, so no other object or ref needs to be
+// rewritten. Objects that cannot be decoded or don't match their hash are left
+// as they are, returning a *CorruptObjectError.
+func ConvertLegacyObject(store ObjectStore, hash string) (bool, error) {
+	data, err := store.Get(hash)
+
+	if err != nil {
+		return false, ErrCouldNotRead
+	}
+
+	if len(data) == 0 || data[0] != '{' {
+		return false, nil
+	}
+
+	objType, body, err := decodeLegacyObject(data)
+
+	if err != nil {
+		return false, &CorruptObjectError{Hash: hash}
+	}
+
+	if err = verifyObject(store.Format(), hash, objType, body); err != nil {
+		return false, err
+	}
+
+	return true, store.Put(hash, EncodeObject(objType, body))
+}
+
+// writeObject encodes and stores an object, returning hash on success and an empty string on failure.
+func writeObject(store ObjectStore, hash string, objType string, body []byte) string {
+	if err := store.Put(hash, EncodeObject(objType, body)); err != nil {
+		return ""
+	}
+
+	return hash
+}
+
+// ErrCorruptObject is matched by errors.Is for every *CorruptObjectError.
+var ErrCorruptObject = errors.New("corrupt object")
+
+// CorruptObjectError is returned when a stored object cannot be decoded or
+// its content does not match its hash.
+type CorruptObjectError struct {
+	Hash string
+	// Actual is the hash of the stored content, or empty if it could not be decoded.
+	Actual string
+}
+
+func (e *CorruptObjectError) Error() string {
+	if e.Actual == "" {
+		return fmt.Sprintf("object %s is corrupt: cannot be decoded", e.Hash)
+	}
+
+	return fmt.Sprintf("object %s is corrupt: content hashes to %s", e.Hash, e.Actual)
+}
+
+func (e *CorruptObjectError) Is(target error) bool {
+	return target == ErrCorruptObject
+}
+
+// verifyObject checks that the object body hashes to the hash it is stored under.
+func verifyObject(format Format, hash string, objType string, body []byte) error {
+	// trees and commits written before canonical serialization existed were
+	// hashed in a way that cannot be reproduced, so only their type is checked
+	if format == FormatLit && objType != TypeBlob && isLegacyBody(body) {
+		return nil
+	}
+
+	if actual := format.HashObject(objType, body); actual != hash {
+		return &CorruptObjectError{Hash: hash, Actual: actual}
+	}
+
+	return nil
+}
+
+// readAnyObject reads the object with the given hash from the store,
+// checking that it matches its hash, and returns its type and body.
+func readAnyObject(store ObjectStore, hash string) (string, []byte, error) {
+	data, err := store.Get(hash)
+
+	if err != nil {
+		return "", nil, ErrCouldNotRead
+	}
+
+	objType, body, err := DecodeObject(data)
+
+	if err != nil {
+		return "", nil, &CorruptObjectError{Hash: hash}
+	}
+
+	if err = verifyObject(store.Format(), hash, objType, body); err != nil {
+		return "", nil, err
+	}
+
+	return objType, body, nil
+}
+
+// readObject reads the object with the given hash from the store, checking
+// that it is of the given type and matches its hash, and returns its body.
+func readObject(store ObjectStore, hash string, objType string) ([]byte, error) {
+	actualType, body, err := readAnyObject(store, hash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if actualType != objType {
+		return nil, ErrNotOfType
+	}
+
+	return body, nil
+}
@@ -0,0 +1,532 @@
+package objects
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format specifies how objects are serialized and how their hashes are
+// computed. Serialization is canonical: equal objects always produce the same
+// bytes, and an object's hash is computed from exactly the bytes stored.
+type Format interface {
+	// Name returns the name the format is selected by, e.g. at lit init.
+	Name() string
+	// HashObject returns the hash of an object with the given type and body.
+	HashObject(objType string, body []byte) string
+	// NewHash returns a hash.Hash computing the hash of an object with the
+	// given type and body size from the body written to it, for hashing
+	// bodies without holding them in memory.
+	NewHash(objType string, size int64) hash.Hash
+	// EncodeTree serializes a tree into its body, failing with
+	// ErrInvalidHash for entries whose hash the format cannot store.
+	EncodeTree(entries map[string]TreeEntry) ([]byte, error)
+	// DecodeTree parses the body of a tree.
+	DecodeTree(body []byte) (map[string]TreeEntry, error)
+	// EncodeCommit serializes a commit into its body.
+	EncodeCommit(commit *Commit) []byte
+	// DecodeCommit parses the body of a commit.
+	DecodeCommit(body []byte) (*Commit, error)
+	// EncodeTag serializes an annotated tag into its body.
+	EncodeTag(tag *Tag) []byte
+	// DecodeTag parses the body of an annotated tag.
+	DecodeTag(body []byte) (*Tag, error)
+}
+
+var (
+	// FormatLit is the native lit object format.
+	FormatLit Format = litFormat{}
+	// FormatSHA1 serializes and hashes objects exactly like git does with its
+	// default sha1 object format.
+	FormatSHA1 Format = &gitFormat{"sha1", sha1.New}
+	// FormatSHA256 serializes and hashes objects exactly like git does with its
+	// sha256 object format.
+	FormatSHA256 Format = &gitFormat{"sha256", sha256.New}
+)
+
+// ErrUnknownFormat is returned by FormatByName for unsupported format names.
+var ErrUnknownFormat = errors.New("unknown object format")
+
+// FormatByName returns the format with the given name.
+func FormatByName(name string) (Format, error) {
+	for _, format := range []Format{FormatLit, FormatSHA1, FormatSHA256} {
+		if format.Name() == name {
+			return format, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, name)
+}
+
+// litFormat hashes the body of objects with sha256. Blobs are stored as is,
+// trees as their entries sorted by name, each written as
+// "<type> <hash> <name>\x00", and commits and tags as a fixed sequence of
+// header lines followed by an empty line and the message.
+type litFormat struct{}
+
+func (litFormat) Name() string {
+	return "lit"
+}
+
+func (litFormat) HashObject(_ string, body []byte) string {
+	return Hash(body)
+}
+
+func (litFormat) NewHash(string, int64) hash.Hash {
+	return sha256.New()
+}
+
+// isLegacyBody reports whether the body of a tree or commit is a JSON document
+// written by a lit version predating canonical serialization.
+func isLegacyBody(body []byte) bool {
+	return len(body) > 0 && body[0] == '{'
+}
+
+// sortedNames returns the names of the tree entries in ascending order.
+func sortedNames(entries map[string]TreeEntry) []string {
+	names := make([]string, 0, len(entries))
+
+	for name := range entries {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func (litFormat) EncodeTree(entries map[string]TreeEntry) ([]byte, error) {
+	var body bytes.Buffer
+
+	for _, name := range sortedNames(entries) {
+		entry := entries[name]
+
+		// entries may come from an index file edited or damaged on disk
+		if len(entry.Hash) != hex.EncodedLen(sha256.Size) || !isHex(entry.Hash) {
+			return nil, fmt.Errorf("%s: %w", name, ErrInvalidHash)
+		}
+
+		body.WriteString(strings.ToLower(entry.ObjType) + " " + entry.Hash + " " + name + "\x00")
+	}
+
+	return body.Bytes(), nil
+}
+
+func (litFormat) DecodeTree(body []byte) (map[string]TreeEntry, error) {
+	result := map[string]TreeEntry{}
+
+	if isLegacyBody(body) {
+		if err := json.Unmarshal(body, &result); err != nil {
+			return nil, ErrMalformedObject
+		}
+
+		return result, nil
+	}
+
+	for len(body) > 0 {
+		entryEnd := bytes.IndexByte(body, 0)
+
+		if entryEnd < 0 {
+			return nil, ErrMalformedObject
+		}
+
+		fields := strings.SplitN(string(body[:entryEnd]), " ", 3)
+
+		if len(fields) != 3 {
+			return nil, ErrMalformedObject
+		}
+
+		switch fields[0] {
+		case "blob":
+			result[fields[2]] = TreeEntry{ObjType: "Blob", Hash: fields[1]}
+		case "tree":
+			result[fields[2]] = TreeEntry{ObjType: "Tree", Hash: fields[1]}
+		default:
+			return nil, ErrMalformedObject
+		}
+
+		body = body[entryEnd+1:]
+	}
+
+	return result, nil
+}
+
+func (litFormat) EncodeCommit(commit *Commit) []byte {
+	var body bytes.Buffer
+
+	body.WriteString("tree " + commit.CommitTree + "\n")
+
+	for _, parent := range commit.Parents {
+		body.WriteString("parent " + parent + "\n")
+	}
+
+	body.WriteString("author " + commit.Author + "\n")
+	body.WriteString("time " + commit.Time.Format(time.RFC3339Nano) + "\n")
+	body.WriteString("\n" + commit.Name)
+
+	return body.Bytes()
+}
+
+func (litFormat) DecodeCommit(body []byte) (*Commit, error) {
+	c := NewCommit("", "", time.Time{})
+
+	if isLegacyBody(body) {
+		if err := json.Unmarshal(body, c); err != nil {
+			return nil, ErrMalformedObject
+		}
+
+		return c, nil
+	}
+
+	headers, message, found := strings.Cut(string(body), "\n\n")
+
+	if !found {
+		return nil, ErrMalformedObject
+	}
+
+	c.Name = message
+
+	for _, line := range strings.Split(headers, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+
+		switch key {
+		case "tree":
+			c.CommitTree = value
+		case "parent":
+			c.Parents = append(c.Parents, value)
+		case "author":
+			c.Author = value
+		case "time":
+			commitTime, err := time.Parse(time.RFC3339Nano, value)
+
+			if err != nil {
+				return nil, ErrMalformedObject
+			}
+
+			c.Time = commitTime
+		default:
+			return nil, ErrMalformedObject
+		}
+	}
+
+	return c, nil
+}
+
+func (litFormat) EncodeTag(tag *Tag) []byte {
+	var body bytes.Buffer
+
+	body.WriteString("object " + tag.Target + "\n")
+	body.WriteString("type " + tag.TargetType + "\n")
+	body.WriteString("tag " + tag.Name + "\n")
+	body.WriteString("tagger " + tag.Tagger + "\n")
+	body.WriteString("time " + tag.Time.Format(time.RFC3339Nano) + "\n")
+	body.WriteString("\n" + tag.Message)
+
+	return body.Bytes()
+}
+
+func (litFormat) DecodeTag(body []byte) (*Tag, error) {
+	headers, message, found := strings.Cut(string(body), "\n\n")
+
+	if !found {
+		return nil, ErrMalformedObject
+	}
+
+	t := &Tag{Message: message}
+
+	for _, line := range strings.Split(headers, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+
+		switch key {
+		case "object":
+			t.Target = value
+		case "type":
+			t.TargetType = value
+		case "tag":
+			t.Name = value
+		case "tagger":
+			t.Tagger = value
+		case "time":
+			tagTime, err := time.Parse(time.RFC3339Nano, value)
+
+			if err != nil {
+				return nil, ErrMalformedObject
+			}
+
+			t.Time = tagTime
+		default:
+			return nil, ErrMalformedObject
+		}
+	}
+
+	return t, nil
+}
+
+// gitFormat is an object format compatible with git, hashing the
+// "<type> <length>\x00" header followed by the body with newHash.
+type gitFormat struct {
+	name    string
+	newHash func() hash.Hash
+}
+
+// git modes of tree entries. lit does not track file permissions, so every
+// blob is written as a regular, non-executable file.
+const (
+	gitModeBlob = "100644"
+	gitModeTree = "40000"
+)
+
+func (f *gitFormat) Name() string {
+	return f.name
+}
+
+func (f *gitFormat) HashObject(objType string, body []byte) string {
+	h := f.NewHash(objType, int64(len(body)))
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (f *gitFormat) NewHash(objType string, size int64) hash.Hash {
+	h := f.newHash()
+	h.Write([]byte(objType + " " + strconv.FormatInt(size, 10) + "\x00"))
+
+	return h
+}
+
+// gitSortKey returns the key git sorts a tree entry by, in which trees are
+// compared as if their name ended with a slash.
+func gitSortKey(name string, entry TreeEntry) string {
+	if entry.ObjType == "Tree" {
+		return name + "/"
+	}
+
+	return name
+}
+
+func (f *gitFormat) EncodeTree(entries map[string]TreeEntry) ([]byte, error) {
+	names := sortedNames(entries)
+
+	sort.SliceStable(names, func(i, j int) bool {
+		return gitSortKey(names[i], entries[names[i]]) < gitSortKey(names[j], entries[names[j]])
+	})
+
+	var body bytes.Buffer
+
+	for _, name := range names {
+		entry := entries[name]
+		mode := gitModeBlob
+
+		if entry.ObjType == "Tree" {
+			mode = gitModeTree
+		}
+
+		// entries may come from an index file edited or damaged on disk
+		rawHash, err := hex.DecodeString(entry.Hash)
+
+		if err != nil || len(rawHash) != f.newHash().Size() {
+			return nil, fmt.Errorf("%s: %w", name, ErrInvalidHash)
+		}
+
+		body.WriteString(mode + " " + name + "\x00")
+		body.Write(rawHash)
+	}
+
+	return body.Bytes(), nil
+}
+
+func (f *gitFormat) DecodeTree(body []byte) (map[string]TreeEntry, error) {
+	hashSize := f.newHash().Size()
+	result := map[string]TreeEntry{}
+
+	for len(body) > 0 {
+		nameEnd := bytes.IndexByte(body, 0)
+
+		if nameEnd < 0 || len(body) < nameEnd+1+hashSize {
+			return nil, ErrMalformedObject
+		}
+
+		mode, name, found := strings.Cut(string(body[:nameEnd]), " ")
+
+		if !found {
+			return nil, ErrMalformedObject
+		}
+
+		objType := "Blob"
+
+		if mode == gitModeTree {
+			objType = "Tree"
+		}
+
+		result[name] = TreeEntry{ObjType: objType, Hash: hex.EncodeToString(body[nameEnd+1 : nameEnd+1+hashSize])}
+		body = body[nameEnd+1+hashSize:]
+	}
+
+	return result, nil
+}
+
+// formatGitTime formats a time the way git stores it in commits: seconds
+// since the unix epoch followed by the timezone offset, e.g. "1650000000 +0200".
+func formatGitTime(t time.Time) string {
+	_, offset := t.Zone()
+	sign := '+'
+
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+
+	return fmt.Sprintf("%d %c%02d%02d", t.Unix(), sign, offset/3600, offset%3600/60)
+}
+
+// parseGitTime parses a time formatted by formatGitTime.
+func parseGitTime(s string) (time.Time, error) {
+	seconds, zone, found := strings.Cut(s, " ")
+
+	if !found || len(zone) != 5 {
+		return time.Time{}, ErrMalformedObject
+	}
+
+	unix, err := strconv.ParseInt(seconds, 10, 64)
+
+	if err != nil {
+		return time.Time{}, ErrMalformedObject
+	}
+
+	hours, errHours := strconv.Atoi(zone[1:3])
+	minutes, errMinutes := strconv.Atoi(zone[3:5])
+
+	if errHours != nil || errMinutes != nil {
+		return time.Time{}, ErrMalformedObject
+	}
+
+	offset := hours*3600 + minutes*60
+
+	if zone[0] == '-' {
+		offset = -offset
+	}
+
+	return time.Unix(unix, 0).In(time.FixedZone("", offset)), nil
+}
+
+func (f *gitFormat) EncodeCommit(commit *Commit) []byte {
+	var body bytes.Buffer
+
+	signature := commit.Author + " " + formatGitTime(commit.Time)
+
+	body.WriteString("tree " + commit.CommitTree + "\n")
+
+	for _, parent := range commit.Parents {
+		// git has no way of representing an empty parent, which older lit versions wrote for root commits
+		if parent != "" {
+			body.WriteString("parent " + parent + "\n")
+		}
+	}
+
+	body.WriteString("author " + signature + "\n")
+	body.WriteString("committer " + signature + "\n")
+	body.WriteString("\n" + commit.Name)
+
+	return body.Bytes()
+}
+
+func (f *gitFormat) DecodeCommit(body []byte) (*Commit, error) {
+	headers, message, found := strings.Cut(string(body), "\n\n")
+
+	if !found {
+		return nil, ErrMalformedObject
+	}
+
+	c := NewCommit(message, "", time.Time{})
+
+	for _, line := range strings.Split(headers, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+
+		switch key {
+		case "tree":
+			c.CommitTree = value
+		case "parent":
+			c.Parents = append(c.Parents, value)
+		case "author":
+			// the identity itself may contain spaces, the time is always the last two fields
+			fields := strings.Split(value, " ")
+
+			if len(fields) < 3 {
+				return nil, ErrMalformedObject
+			}
+
+			commitTime, err := parseGitTime(strings.Join(fields[len(fields)-2:], " "))
+
+			if err != nil {
+				return nil, err
+			}
+
+			c.Author = strings.Join(fields[:len(fields)-2], " ")
+			c.Time = commitTime
+		}
+	}
+
+	return c, nil
+}
+
+func (f *gitFormat) EncodeTag(tag *Tag) []byte {
+	var body bytes.Buffer
+
+	body.WriteString("object " + tag.Target + "\n")
+	body.WriteString("type " + tag.TargetType + "\n")
+	body.WriteString("tag " + tag.Name + "\n")
+	body.WriteString("tagger " + tag.Tagger + " " + formatGitTime(tag.Time) + "\n")
+	body.WriteString("\n" + tag.Message)
+
+	return body.Bytes()
+}
+
+func (f *gitFormat) DecodeTag(body []byte) (*Tag, error) {
+	headers, message, found := strings.Cut(string(body), "\n\n")
+
+	if !found {
+		return nil, ErrMalformedObject
+	}
+
+	t := &Tag{Message: message}
+
+	for _, line := range strings.Split(headers, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+
+		switch key {
+		case "object":
+			t.Target = value
+		case "type":
+			t.TargetType = value
+		case "tag":
+			t.Name = value
+		case "tagger":
+			// the identity itself may contain spaces, the time is always the last two fields
+			fields := strings.Split(value, " ")
+
+			if len(fields) < 3 {
+				return nil, ErrMalformedObject
+			}
+
+			tagTime, err := parseGitTime(strings.Join(fields[len(fields)-2:], " "))
+
+			if err != nil {
+				return nil, err
+			}
+
+			t.Tagger = strings.Join(fields[:len(fields)-2], " ")
+			t.Time = tagTime
+		}
+	}
+
+	return t, nil
+}
@@ -0,0 +1,144 @@
+package objects
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// gitHashes are the hashes git computes for the objects written by writeGitObjects.
+type gitHashes struct {
+	blob, nested, other, subtree, tree, commit, child string
+}
+
+// hashes computed by git with --object-format=sha1 and sha256
+var knownGitHashes = map[Format]gitHashes{
+	FormatSHA1: {
+		blob:    "ce013625030ba8dba906f756967f9e9ca394464a",
+		nested:  "79c53955ef856f16f2107446bc721c8879a1bd2e",
+		other:   "c1b0730e0133447badcfd47fd144e254807b06e1",
+		subtree: "bd6bc799012984c0083beb6c9448d3ea68c214cf",
+		tree:    "cbc5de3ee6731a82f59975bc2f4836a4a3c36761",
+		commit:  "742782ab5c12772f3916717d34ca23b0ac704731",
+		child:   "358e3cde3e0113e5fda9b9ed4c631023b8c31f00",
+	},
+	FormatSHA256: {
+		blob:    "2cf8d83d9ee29543b34a87727421fdecb7e3f3a183d337639025de576db9ebb4",
+		nested:  "901dd740cdbc4bf5ec97deb7308876c6e3b326fcbf34e4e86686f76e01e8da82",
+		other:   "4b6cea43da6e13c24f191bcb97b51a58781d1ccdd8281d96291a2582f5177b78",
+		subtree: "6a75e159d58678c406b1b16e068c6ce3c599e8d5132f393a9384ecaf4de24d7b",
+		tree:    "be2429b4e9f2ac8010067e00a32d485072acf4ea876fd7da2ea20425632c2ada",
+		commit:  "5087d2203c1ad9b39eb6c04c2e12cd996acee85097c1ec4dc3da63a81ee3083f",
+		child:   "51ea501ee4011bf1702ad14220cdf8899cccad967d43d374bbe1c989fab685f5",
+	},
+}
+
+// writeGitObjects writes the history git was given to compute knownGitHashes:
+//
+//	hello.txt  "hello\n"
+//	a.txt      "x"
+//	a/b.txt    "nested\n"
+//
+// committed as a root commit and again as its child.
+func writeGitObjects(t *testing.T, store ObjectStore) gitHashes {
+	var written gitHashes
+	var err error
+
+	written.blob = WriteBlob(store, []byte("hello\n"))
+	written.nested = WriteBlob(store, []byte("nested\n"))
+	written.other = WriteBlob(store, []byte("x"))
+	written.subtree, err = WriteTree(store, map[string]TreeEntry{
+		"b.txt": {ObjType: "Blob", Hash: written.nested},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// git sorts a.txt before the tree a, as trees sort as if named a/
+	written.tree, err = WriteTree(store, map[string]TreeEntry{
+		"hello.txt": {ObjType: "Blob", Hash: written.blob},
+		"a":         {ObjType: "Tree", Hash: written.subtree},
+		"a.txt":     {ObjType: "Blob", Hash: written.other},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	author := "Ada Lovelace <ada@example.com>"
+	root := &Commit{Name: "initial commit\n", CommitTree: written.tree, Time: time.Unix(1650000000, 0).In(time.FixedZone("", 2*3600)), Author: author}
+	written.commit = WriteCommit(store, root)
+
+	child := &Commit{Name: "second\n", CommitTree: written.tree, Parents: []string{written.commit}, Time: time.Unix(1650003600, 0).In(time.FixedZone("", -90*60)), Author: author}
+	written.child = WriteCommit(store, child)
+
+	return written
+}
+
+func TestGitFormatsMatchGitHashes(t *testing.T) {
+	for format, expected := range knownGitHashes {
+		t.Run(format.Name(), func(t *testing.T) {
+			written := writeGitObjects(t, NewMemoryStore(format))
+
+			if written != expected {
+				t.Errorf("wrote\n%+v\nbut git computes\n%+v", written, expected)
+			}
+		})
+	}
+}
+
+func TestGitFormatsRoundTripCommits(t *testing.T) {
+	for format := range knownGitHashes {
+		t.Run(format.Name(), func(t *testing.T) {
+			store := NewMemoryStore(format)
+			written := writeGitObjects(t, store)
+
+			commit, err := ReadAsCommit(store, written.child)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if commit.CommitTree != written.tree || len(commit.Parents) != 1 || commit.Parents[0] != written.commit {
+				t.Errorf("read tree %s and parents %v, want %s and [%s]", commit.CommitTree, commit.Parents, written.tree, written.commit)
+			}
+
+			if _, offset := commit.Time.Zone(); commit.Time.Unix() != 1650003600 || offset != -90*60 {
+				t.Errorf("read time %v, want 1650003600 -0130", commit.Time)
+			}
+
+			// the commit is written again unchanged
+			if rewritten := WriteCommit(store, commit); rewritten != written.child {
+				t.Errorf("rewriting the commit gives %s, want %s", rewritten, written.child)
+			}
+
+			tree, err := ReadAsTree(store, written.tree)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if entry := tree["a"]; entry.ObjType != "Tree" || entry.Hash != written.subtree {
+				t.Errorf("read entry a as %+v, want tree %s", entry, written.subtree)
+			}
+		})
+	}
+}
+
+func TestWriteTreeRejectsInvalidHashes(t *testing.T) {
+	for _, format := range []Format{FormatLit, FormatSHA1, FormatSHA256} {
+		t.Run(format.Name(), func(t *testing.T) {
+			store := NewMemoryStore(format)
+			blob := WriteBlob(store, []byte("content"))
+
+			for _, hash := range []string{"", "abc", "not hex", blob + " x", blob[1:] + "\x00"} {
+				entries := map[string]TreeEntry{"file": {ObjType: "Blob", Hash: hash}}
+
+				if _, err := WriteTree(store, entries); !errors.Is(err, ErrInvalidHash) {
+					t.Errorf("writing a tree with hash %q gave error %v, want ErrInvalidHash", hash, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package objects
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"lit/util"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LooseStore is an ObjectStore keeping every object in its own file under a
+// directory, using the first FolderCharacters of the hash as a subdirectory
+// (e.g. .lit/objects/ab/cdef...).
+type LooseStore struct {
+	dir    string
+	format Format
+}
+
+// NewLooseStore returns a LooseStore rooted at dir holding objects of the given format.
+func NewLooseStore(dir string, format Format) *LooseStore {
+	return &LooseStore{dir, format}
+}
+
+func (s *LooseStore) Format() Format {
+	return s.format
+}
+
+// validHash reports whether hash can name a loose object, so that paths
+// built from it stay inside the directory of the store.
+func validHash(hash string) bool {
+	return len(hash) > FolderCharacters && isHex(hash)
+}
+
+// HashPath returns the path of the file the object with the given hash is
+// stored in, failing with ErrInvalidHash for anything but a lowercase
+// hexadecimal hash.
+func (s *LooseStore) HashPath(hash string) (string, error) {
+	if !validHash(hash) {
+		return "", ErrInvalidHash
+	}
+
+	return filepath.Join(s.dir, hash[:FolderCharacters], hash[FolderCharacters:]), nil
+}
+
+func (s *LooseStore) Put(hash string, data []byte) error {
+	if !validHash(hash) {
+		return ErrInvalidHash
+	}
+
+	writer, err := s.NewWriter()
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = writer.Write(data); err != nil {
+		writer.Abort()
+		return err
+	}
+
+	return writer.Commit(hash)
+}
+
+func (s *LooseStore) Get(hash string) ([]byte, error) {
+	path, err := s.HashPath(hash)
+
+	if err != nil {
+		return nil, ErrObjectNotFound
+	}
+
+	data, err := os.ReadFile(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+
+	return data, err
+}
+
+func (s *LooseStore) Has(hash string) (bool, error) {
+	path, err := s.HashPath(hash)
+
+	if err != nil {
+		return false, nil
+	}
+
+	_, err = os.Stat(path)
+
+	if err == nil {
+		return true, nil
+	}
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+
+	return false, err
+}
+
+// iterateFolder calls f with the hash of every object in the given
+// FolderCharacters-long subdirectory.
+func (s *LooseStore) iterateFolder(folder string, f func(hash string) error) error {
+	entries, err := os.ReadDir(filepath.Join(s.dir, folder))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		// temporary and foreign files are not objects
+		if entry.IsDir() || !validHash(folder+entry.Name()) {
+			continue
+		}
+
+		if err = f(folder + entry.Name()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *LooseStore) Iterate(f func(hash string) error) error {
+	folders, err := os.ReadDir(s.dir)
+
+	if err != nil {
+		return err
+	}
+
+	for _, folder := range folders {
+		if !folder.IsDir() || len(folder.Name()) != FolderCharacters || !isHex(folder.Name()) {
+			continue
+		}
+
+		if err = s.iterateFolder(folder.Name(), f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *LooseStore) ResolvePrefix(prefix string) ([]string, error) {
+	prefix = strings.ToLower(prefix)
+	result := []string{}
+
+	if !isHex(prefix) {
+		return result, nil
+	}
+
+	collect := func(hash string) error {
+		if strings.HasPrefix(hash, prefix) {
+			result = append(result, hash)
+		}
+
+		return nil
+	}
+
+	var err error
+
+	// with a long enough prefix only a single folder has to be searched
+	if len(prefix) >= FolderCharacters {
+		err = s.iterateFolder(prefix[:FolderCharacters], collect)
+	} else {
+		err = s.Iterate(collect)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// looseWriter writes a loose object to a temporary file, which is renamed to
+// the object's path once its hash is known.
+type looseWriter struct {
+	*os.File
+	store *LooseStore
+}
+
+func (s *LooseStore) NewWriter() (ObjectWriter, error) {
+	if err := os.MkdirAll(s.dir, 0777); err != nil {
+		return nil, err
+	}
+
+	file, err := os.CreateTemp(s.dir, "tmp-object-")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &looseWriter{file, s}, nil
+}
+
+func (w *looseWriter) Commit(hash string) error {
+	// objects must be on disk before any ref can point to them
+	if err := w.Sync(); err != nil {
+		w.Close()
+		os.Remove(w.Name())
+
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	path, err := w.store.HashPath(hash)
+
+	if err != nil {
+		os.Remove(w.Name())
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+
+	if err := os.Rename(w.Name(), path); err != nil {
+		return err
+	}
+
+	util.SyncDir(filepath.Dir(path))
+
+	return nil
+}
+
+func (w *looseWriter) Abort() error {
+	w.Close()
+
+	return os.Remove(w.Name())
+}
+
+func (s *LooseStore) Open(hash string) (io.ReadCloser, error) {
+	path, err := s.HashPath(hash)
+
+	if err != nil {
+		return nil, ErrObjectNotFound
+	}
+
+	file, err := os.Open(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
@@ -0,0 +1,50 @@
+package objects
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLooseStoreRejectsInvalidHashes(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "objects")
+	store := NewLooseStore(dir, FormatLit)
+	blob := WriteBlob(store, []byte("content"))
+
+	// a file outside the store a path traversal could reach
+	if err := os.WriteFile(filepath.Join(root, "outside"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, hash := range []string{"", "ab", "../outside", "../../outside", "ab/../../outside", "ABCDEF", blob + "/"} {
+		if _, err := store.Get(hash); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("Get(%q) gave error %v, want ErrObjectNotFound", hash, err)
+		}
+
+		if exists, err := store.Has(hash); exists || err != nil {
+			t.Errorf("Has(%q) gave %v, %v", hash, exists, err)
+		}
+
+		if _, err := store.Open(hash); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("Open(%q) gave error %v, want ErrObjectNotFound", hash, err)
+		}
+
+		if _, err := store.HashPath(hash); !errors.Is(err, ErrInvalidHash) {
+			t.Errorf("HashPath(%q) gave error %v, want ErrInvalidHash", hash, err)
+		}
+
+		if err := store.Put(hash, []byte("data")); !errors.Is(err, ErrInvalidHash) {
+			t.Errorf("Put(%q) gave error %v, want ErrInvalidHash", hash, err)
+		}
+	}
+
+	if matches, err := store.ResolvePrefix("../"); err != nil || len(matches) != 0 {
+		t.Errorf("ResolvePrefix(\"../\") gave %v, %v", matches, err)
+	}
+
+	if matches, err := store.ResolvePrefix(blob[:6]); err != nil || len(matches) != 1 || matches[0] != blob {
+		t.Errorf("ResolvePrefix of a valid prefix gave %v, %v", matches, err)
+	}
+}
@@ -0,0 +1,100 @@
+package objects
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryStore is an ObjectStore keeping every object in memory. It is safe
+// for concurrent use and is meant for tests and tools embedding lit that must
+// not touch the disk.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	objects map[string][]byte
+	format  Format
+}
+
+// NewMemoryStore returns an empty MemoryStore holding objects of the given format.
+func NewMemoryStore(format Format) *MemoryStore {
+	return &MemoryStore{objects: map[string][]byte{}, format: format}
+}
+
+func (s *MemoryStore) Format() Format {
+	return s.format
+}
+
+func (s *MemoryStore) Put(hash string, data []byte) error {
+	if hash == "" {
+		return ErrInvalidHash
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[hash] = append([]byte(nil), data...)
+
+	return nil
+}
+
+func (s *MemoryStore) Get(hash string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, exists := s.objects[hash]
+
+	if !exists {
+		return nil, ErrObjectNotFound
+	}
+
+	return append([]byte(nil), data...), nil
+}
+
+func (s *MemoryStore) Has(hash string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, exists := s.objects[hash]
+
+	return exists, nil
+}
+
+// hashes returns every stored hash in sorted order.
+func (s *MemoryStore) hashes() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]string, 0, len(s.objects))
+
+	for hash := range s.objects {
+		result = append(result, hash)
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+func (s *MemoryStore) Iterate(f func(hash string) error) error {
+	// iterate over a snapshot so f may write to the store
+	for _, hash := range s.hashes() {
+		if err := f(hash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) ResolvePrefix(prefix string) ([]string, error) {
+	prefix = strings.ToLower(prefix)
+	result := []string{}
+
+	for _, hash := range s.hashes() {
+		if strings.HasPrefix(hash, prefix) {
+			result = append(result, hash)
+		}
+	}
+
+	return result, nil
+}
@@ -2,12 +2,9 @@ package objects
 
 import (
 	"errors"
-	"fmt"
-	"io/fs"
-	"lit/util"
+	"io"
 	"os"
 	"path/filepath"
-	"strings"
 )
 
 // FolderCharacters specifies how many characters of the object's hash go into
@@ -17,105 +14,81 @@ const FolderCharacters = 2
 var (
 	ErrNotOfType    = errors.New("not of the required type")
 	ErrCouldNotRead = errors.New("could not read file")
+	ErrInvalidHash  = errors.New("invalid object hash")
 )
 
-func LoadTree(basePath string, tree map[string]TreeEntry) error {
+// LoadTree writes the tree into the directory dir, returning the
+// slash-separated paths of the written files relative to dir.
+func LoadTree(store ObjectStore, dir string, tree map[string]TreeEntry) ([]string, error) {
+	created := []string{}
+
 	for name, entry := range tree {
+		path := filepath.Join(dir, name)
+
 		if entry.ObjType == "Tree" {
-			subtree, err := ReadAsTree(entry.Hash)
+			subtree, err := ReadAsTree(store, entry.Hash)
 
 			if err != nil {
-				return err
+				return nil, err
 			}
 
 			if len(subtree) != 0 {
-				err = os.MkdirAll(basePath+name, 0777)
+				err = os.MkdirAll(path, 0777)
 
 				if err != nil {
-					return err
+					return nil, err
 				}
 			}
 
-			err = LoadTree(basePath+name+"/", subtree)
+			subCreated, err := LoadTree(store, path, subtree)
 
 			if err != nil {
-				return err
+				return nil, err
 			}
 
-			continue
-		}
-
-		blob, err := ReadAsBlob(entry.Hash)
+			for _, subPath := range subCreated {
+				created = append(created, name+"/"+subPath)
+			}
 
-		if err != nil {
-			return err
+			continue
 		}
 
-		err = os.WriteFile(basePath+name, []byte(blob), 0777)
-
-		if err != nil {
-			return err
+		if err := writeBlobToFile(store, entry.Hash, path); err != nil {
+			return nil, err
 		}
 
-		fmt.Println("created", basePath+name)
+		created = append(created, name)
 	}
 
-	return nil
+	return created, nil
 }
 
+// writeBlobToFile streams the content of the blob with the given hash into
+// the file at path, removing the file if the blob cannot be read completely.
+func writeBlobToFile(store ObjectStore, hash string, path string) error {
+	blob, err := OpenBlob(store, hash)
 
-// concatLastPathElems gets the n last slash-seperated elements of a path and concatenates them. E.g. if
-// path is foo/bar/baz, and n is 2, the result is barbaz. If n is greater than
-// the amount of elements in path, concatLastPathElems will return every element of the path
-// concatenated together.
-func concatLastPathElems(path string, n int) string {
-	elements := strings.Split(path, "/")
-
-	if n > len(elements) {
-		return strings.Join(elements, "")
-	} else {
-		return strings.Join(elements[len(elements)-n:], "")
+	if err != nil {
+		return err
 	}
-}
 
-func ExpandHash(hash string) (string, error) {
-	hash = strings.ToLower(hash)
-	result := ""
+	defer blob.Close()
 
-	err := filepath.Walk(".lit/objects/", func(path string, info fs.FileInfo, err error) error {
-		cleanPath := util.CleanPath(path)
-		if info.IsDir() {
-			if cleanPath == ".lit/objects" {
-				return nil
-			}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
 
-			if info.Name() != hash[:FolderCharacters] {
-				return filepath.SkipDir
-			}
-
-			return nil
-		} else {
-			hash := concatLastPathElems(cleanPath, 2)
-
-			if !strings.HasPrefix(info.Name(), hash[FolderCharacters:]) {
-				return filepath.SkipDir
-			}
-
-			isCommit := HashIsCommit(hash)
-
-			if !isCommit {
-				return filepath.SkipDir
-			}
+	if err != nil {
+		return err
+	}
 
-			result = hash
+	_, err = io.Copy(file, blob)
 
-			return nil
-		}
-	})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
 
 	if err != nil {
-		return "", err
+		os.Remove(path)
 	}
 
-	return result, nil
+	return err
 }
@@ -0,0 +1,570 @@
+package objects
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"lit/util"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/*
+A pack consists of two files named after the checksum of the pack file:
+
+pack-<checksum>.pack holds many objects in the form they are stored in:
+
+	"LPCK" | version uint32 | object count uint32
+	for every object: kind byte | data length uvarint | data
+	sha256 checksum of everything above
+
+The data of a whole record is the stored data of the object. The data of a
+delta record is the raw hash of a base object in the same pack followed by a
+compressed delta building the uncompressed object from the uncompressed base.
+
+pack-<checksum>.idx lists the objects of the pack sorted by hash, so objects
+can be found by binary search:
+
+	"LIDX" | version uint32 | object count uint32 | hash size uint32
+	for every object: raw hash [hash size]byte | record offset uint64
+	checksum of the pack file
+
+All integers are big-endian.
+*/
+
+const (
+	packMagic   = "LPCK"
+	indexMagic  = "LIDX"
+	packVersion = 1
+
+	packHeaderSize  = 12
+	indexHeaderSize = 16
+)
+
+// kinds of records in a pack
+const (
+	// recordWhole holds the stored data of an object.
+	recordWhole byte = iota
+	// recordDelta holds a delta against another object of the pack.
+	recordDelta
+)
+
+// maxDeltaChain bounds the chains of deltas followed when reading, guarding
+// against cycles in malformed packs.
+const maxDeltaChain = 1000
+
+// ErrMalformedPack is returned when a pack or its index cannot be parsed.
+var ErrMalformedPack = errors.New("malformed pack")
+
+// Pack is a read-only pack of objects together with its index.
+type Pack struct {
+	// Path is the path of the pack file.
+	Path string
+
+	hashSize int
+	count    int
+	// entries holds the index entries: raw hash followed by the record offset
+	entries []byte
+}
+
+// OpenPack opens the pack at path, reading its index into memory.
+func OpenPack(path string) (*Pack, error) {
+	index, err := os.ReadFile(strings.TrimSuffix(path, ".pack") + ".idx")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(index) < indexHeaderSize || string(index[:4]) != indexMagic || binary.BigEndian.Uint32(index[4:]) != packVersion {
+		return nil, ErrMalformedPack
+	}
+
+	count := int(binary.BigEndian.Uint32(index[8:]))
+	hashSize := int(binary.BigEndian.Uint32(index[12:]))
+	entriesEnd := indexHeaderSize + count*(hashSize+8)
+
+	if hashSize == 0 || len(index) != entriesEnd+sha256.Size {
+		return nil, ErrMalformedPack
+	}
+
+	return &Pack{path, hashSize, count, index[indexHeaderSize:entriesEnd]}, nil
+}
+
+// Len returns the number of objects in the pack.
+func (p *Pack) Len() int {
+	return p.count
+}
+
+// hashAt returns the hex-encoded hash of the i-th index entry.
+func (p *Pack) hashAt(i int) string {
+	start := i * (p.hashSize + 8)
+
+	return hex.EncodeToString(p.entries[start : start+p.hashSize])
+}
+
+// offsetAt returns the record offset of the i-th index entry.
+func (p *Pack) offsetAt(i int) int64 {
+	start := i*(p.hashSize+8) + p.hashSize
+
+	return int64(binary.BigEndian.Uint64(p.entries[start:]))
+}
+
+// search returns the position of the first index entry whose hash is not less than hash.
+func (p *Pack) search(hash string) int {
+	return sort.Search(p.count, func(i int) bool {
+		return p.hashAt(i) >= hash
+	})
+}
+
+// find returns the position of the index entry of hash, or -1 if it is not in the pack.
+func (p *Pack) find(hash string) int {
+	i := p.search(hash)
+
+	if i < p.count && p.hashAt(i) == hash {
+		return i
+	}
+
+	return -1
+}
+
+// Has reports whether the object with the given hash is in the pack.
+func (p *Pack) Has(hash string) bool {
+	return p.find(hash) >= 0
+}
+
+// Hashes returns the hashes of every object in the pack in ascending order.
+func (p *Pack) Hashes() []string {
+	result := make([]string, p.count)
+
+	for i := range result {
+		result[i] = p.hashAt(i)
+	}
+
+	return result
+}
+
+// ResolvePrefix returns the hashes of the objects in the pack starting with prefix.
+func (p *Pack) ResolvePrefix(prefix string) []string {
+	result := []string{}
+
+	for i := p.search(prefix); i < p.count; i++ {
+		hash := p.hashAt(i)
+
+		if !strings.HasPrefix(hash, prefix) {
+			break
+		}
+
+		result = append(result, hash)
+	}
+
+	return result
+}
+
+// readHeader reads the header of the record at the given offset of the open
+// pack file, returning the kind of the record, the length of its data and the
+// offset of its data. Lengths reaching past the end of the pack are rejected.
+func (p *Pack) readHeader(file *os.File, offset int64) (byte, int64, int64, error) {
+	info, err := file.Stat()
+
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	// records lie between the header and the checksum of the pack
+	end := info.Size() - sha256.Size
+
+	if offset < packHeaderSize || offset >= end {
+		return 0, 0, 0, ErrMalformedPack
+	}
+
+	// the record header is at most a kind byte followed by a uvarint
+	header := make([]byte, 1+binary.MaxVarintLen64)
+	n, err := file.ReadAt(header, offset)
+
+	if err != nil && err != io.EOF {
+		return 0, 0, 0, err
+	}
+
+	length, lengthSize := binary.Uvarint(header[1:n])
+	dataOffset := offset + 1 + int64(lengthSize)
+
+	if lengthSize <= 0 || dataOffset > end || length > uint64(end-dataOffset) {
+		return 0, 0, 0, ErrMalformedPack
+	}
+
+	return header[0], int64(length), dataOffset, nil
+}
+
+// readRecord reads the record at the given offset, returning its kind and data.
+func (p *Pack) readRecord(offset int64) (byte, []byte, error) {
+	file, err := os.Open(p.Path)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	defer file.Close()
+
+	kind, length, dataOffset, err := p.readHeader(file, offset)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	data := make([]byte, length)
+
+	if _, err = file.ReadAt(data, dataOffset); err != nil {
+		return 0, nil, ErrMalformedPack
+	}
+
+	return kind, data, nil
+}
+
+// Get returns the stored data of the object with the given hash, or
+// ErrObjectNotFound. Objects stored as deltas are reconstructed.
+func (p *Pack) Get(hash string) ([]byte, error) {
+	i := p.find(hash)
+
+	if i < 0 {
+		return nil, ErrObjectNotFound
+	}
+
+	kind, data, err := p.readRecord(p.offsetAt(i))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if kind == recordWhole {
+		return data, nil
+	}
+
+	raw, err := p.resolveDelta(kind, data, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return compress(raw), nil
+}
+
+// getRaw returns the uncompressed data of the object with the given hash,
+// which is depth deltas deep into a delta chain.
+func (p *Pack) getRaw(hash string, depth int) ([]byte, error) {
+	i := p.find(hash)
+
+	if i < 0 {
+		return nil, ErrMalformedPack // delta bases are always in the same pack
+	}
+
+	kind, data, err := p.readRecord(p.offsetAt(i))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if kind == recordWhole {
+		return decompress(data)
+	}
+
+	return p.resolveDelta(kind, data, depth)
+}
+
+// resolveDelta reconstructs the uncompressed data of a delta record.
+func (p *Pack) resolveDelta(kind byte, data []byte, depth int) ([]byte, error) {
+	if kind != recordDelta || len(data) < p.hashSize || depth > maxDeltaChain {
+		return nil, ErrMalformedPack
+	}
+
+	base, err := p.getRaw(hex.EncodeToString(data[:p.hashSize]), depth+1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	delta, err := decompress(data[p.hashSize:])
+
+	if err != nil {
+		return nil, err
+	}
+
+	return applyDelta(base, delta)
+}
+
+// sectionReadCloser reads a section of a file, closing the file when closed.
+type sectionReadCloser struct {
+	*io.SectionReader
+	file *os.File
+}
+
+func (r sectionReadCloser) Close() error {
+	return r.file.Close()
+}
+
+// Open opens the stored data of the object with the given hash for reading,
+// or returns ErrObjectNotFound. Only objects stored as deltas are read into memory.
+func (p *Pack) Open(hash string) (io.ReadCloser, error) {
+	i := p.find(hash)
+
+	if i < 0 {
+		return nil, ErrObjectNotFound
+	}
+
+	file, err := os.Open(p.Path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	kind, length, dataOffset, err := p.readHeader(file, p.offsetAt(i))
+
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if kind != recordWhole {
+		file.Close()
+
+		data, err := p.Get(hash)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	section := io.NewSectionReader(file, dataOffset, length)
+
+	return sectionReadCloser{section, file}, nil
+}
+
+// IsDelta reports whether the object with the given hash is stored as a delta in the pack.
+func (p *Pack) IsDelta(hash string) bool {
+	i := p.find(hash)
+
+	if i < 0 {
+		return false
+	}
+
+	kind, _, err := p.readRecord(p.offsetAt(i))
+
+	return err == nil && kind == recordDelta
+}
+
+// PackOptions configures how WritePack stores objects.
+type PackOptions struct {
+	// DeltaDepth is the maximum length of delta chains. Zero disables deltas.
+	DeltaDepth int
+	// DeltaWindow is the number of similar blobs tried as delta base for each blob.
+	DeltaWindow int
+	// DeltaMaxSize is the size in bytes of the largest blob stored as or used
+	// as a delta. Larger blobs are streamed into the pack whole, as deltas
+	// need both versions in memory.
+	DeltaMaxSize int64
+}
+
+// DefaultPackOptions are the options used when packing without further configuration.
+var DefaultPackOptions = PackOptions{DeltaDepth: 10, DeltaWindow: 10, DeltaMaxSize: 16 << 20}
+
+// packWriter writes a pack file, keeping track of the offset of the next record.
+type packWriter struct {
+	writer *bufio.Writer
+	offset uint64
+}
+
+func (w *packWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.offset += uint64(n)
+
+	return n, err
+}
+
+// writeRecordHeader writes the kind and data length of a record.
+func (w *packWriter) writeRecordHeader(kind byte, length uint64) error {
+	header := make([]byte, 1+binary.MaxVarintLen64)
+	header[0] = kind
+
+	_, err := w.Write(header[:1+binary.PutUvarint(header[1:], length)])
+
+	return err
+}
+
+// openSized opens the stored data of the object with the given hash,
+// returning its length as well. Data is only read into memory if the store
+// cannot tell its length up front.
+func openSized(store ObjectStore, hash string) (io.ReadCloser, int64, error) {
+	reader, err := openStored(store, hash)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch sized := reader.(type) {
+	case *os.File:
+		info, err := sized.Stat()
+
+		if err != nil {
+			sized.Close()
+			return nil, 0, err
+		}
+
+		return sized, info.Size(), nil
+	case sectionReadCloser:
+		return sized, sized.Size(), nil
+	}
+
+	data, err := io.ReadAll(reader)
+	reader.Close()
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), int64(len(data)), nil
+}
+
+// WritePack writes the objects with the given hashes from the store into a
+// new pack in the directory dir, returning the path of the pack file and the
+// number of objects stored as deltas. Objects are streamed into a temporary
+// file, so the pack is never held in memory.
+func WritePack(dir string, store ObjectStore, hashes []string, options PackOptions) (string, int, error) {
+	hashes = append([]string(nil), hashes...)
+	sort.Strings(hashes)
+
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return "", 0, err
+	}
+
+	deltas := map[string]plannedDelta{}
+
+	if options.DeltaDepth > 0 {
+		var err error
+
+		if deltas, err = planDeltas(store, hashes, options); err != nil {
+			return "", 0, err
+		}
+	}
+
+	file, err := os.CreateTemp(dir, "tmp-pack-")
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	// only fails after a successful rename, when there is nothing to clean up
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	checksum := sha256.New()
+	pack := &packWriter{writer: bufio.NewWriter(io.MultiWriter(file, checksum))}
+
+	pack.Write([]byte(packMagic))
+	binary.Write(pack, binary.BigEndian, uint32(packVersion))
+	binary.Write(pack, binary.BigEndian, uint32(len(hashes)))
+
+	offsets := make([]uint64, len(hashes))
+
+	for i, hash := range hashes {
+		offsets[i] = pack.offset
+
+		if delta, isDelta := deltas[hash]; isDelta {
+			rawBase, _ := hex.DecodeString(delta.base)
+
+			pack.writeRecordHeader(recordDelta, uint64(len(rawBase)+len(delta.data)))
+			pack.Write(rawBase)
+			pack.Write(delta.data)
+
+			continue
+		}
+
+		reader, length, err := openSized(store, hash)
+
+		if err != nil {
+			return "", 0, err
+		}
+
+		pack.writeRecordHeader(recordWhole, uint64(length))
+		copied, err := io.Copy(pack, reader)
+		reader.Close()
+
+		if err != nil {
+			return "", 0, err
+		}
+
+		if copied != length {
+			return "", 0, ErrSizeChanged
+		}
+	}
+
+	// errors of earlier writes are kept by the buffered writer and returned here
+	if err = pack.writer.Flush(); err != nil {
+		return "", 0, err
+	}
+
+	sum := checksum.Sum(nil)
+
+	if _, err = file.Write(sum); err != nil {
+		return "", 0, err
+	}
+
+	if err = file.Sync(); err != nil {
+		return "", 0, err
+	}
+
+	if err = file.Close(); err != nil {
+		return "", 0, err
+	}
+
+	var index bytes.Buffer
+
+	hashSize := 0
+
+	if len(hashes) > 0 {
+		hashSize = len(hashes[0]) / 2
+	}
+
+	index.WriteString(indexMagic)
+	binary.Write(&index, binary.BigEndian, uint32(packVersion))
+	binary.Write(&index, binary.BigEndian, uint32(len(hashes)))
+	binary.Write(&index, binary.BigEndian, uint32(hashSize))
+
+	for i, hash := range hashes {
+		rawHash, err := hex.DecodeString(hash)
+
+		if err != nil || len(rawHash) != hashSize {
+			return "", 0, ErrInvalidHash
+		}
+
+		index.Write(rawHash)
+		binary.Write(&index, binary.BigEndian, offsets[i])
+	}
+
+	index.Write(sum)
+
+	base := filepath.Join(dir, "pack-"+hex.EncodeToString(sum))
+
+	if err = os.Chmod(file.Name(), 0644); err != nil {
+		return "", 0, err
+	}
+
+	// the index is written last, as a pack without an index is ignored
+	if err = os.Rename(file.Name(), base+".pack"); err != nil {
+		return "", 0, err
+	}
+
+	util.SyncDir(dir)
+
+	if err = util.WriteFileAtomic(base+".idx", index.Bytes(), 0644); err != nil {
+		return "", 0, err
+	}
+
+	return base + ".pack", len(deltas), nil
+}
@@ -0,0 +1,113 @@
+package objects
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// PruneResult describes what Prune removed.
+type PruneResult struct {
+	// Objects is the number of loose objects removed.
+	Objects int
+	// Bytes is the disk space freed, including leftover temporary files.
+	Bytes int64
+}
+
+// Prune removes the loose objects for which keep returns false and that were
+// last modified before cutoff, as well as temporary files left behind by
+// interrupted writes before cutoff. Recent objects are kept because another
+// process may be about to reference them. Removed objects are dropped from
+// DefaultCache.
+func (s *LooseStore) Prune(keep func(hash string) bool, cutoff time.Time) (PruneResult, error) {
+	result := PruneResult{}
+	candidates := []string{}
+	removed := map[string]bool{}
+
+	// also drop the objects removed before a failure
+	defer DefaultCache.remove(removed)
+
+	err := s.Iterate(func(hash string) error {
+		if !keep(hash) {
+			candidates = append(candidates, hash)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return result, err
+	}
+
+	for _, hash := range candidates {
+		path, err := s.HashPath(hash)
+
+		if err != nil {
+			return result, err
+		}
+
+		wasRemoved, size, err := removeIfOlder(path, cutoff)
+
+		if err != nil {
+			return result, err
+		}
+
+		if wasRemoved {
+			removed[hash] = true
+			result.Objects++
+			result.Bytes += size
+		}
+	}
+
+	temporary, err := filepath.Glob(filepath.Join(s.dir, "tmp-object-*"))
+
+	if err != nil {
+		return result, err
+	}
+
+	for _, path := range temporary {
+		_, size, err := removeIfOlder(path, cutoff)
+
+		if err != nil {
+			return result, err
+		}
+
+		result.Bytes += size
+	}
+
+	removeEmptyFolders(s.dir)
+
+	return result, nil
+}
+
+// removeIfOlder removes the file at path if it was last modified before
+// cutoff, returning whether it did and the size of the file removed.
+func removeIfOlder(path string, cutoff time.Time) (bool, int64, error) {
+	info, err := os.Stat(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, 0, nil
+	}
+
+	if err != nil {
+		return false, 0, err
+	}
+
+	if !info.ModTime().Before(cutoff) {
+		return false, 0, nil
+	}
+
+	if err = os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, 0, err
+	}
+
+	return true, info.Size(), nil
+}
+
+// Prune removes unreferenced loose objects as described by LooseStore.Prune.
+// Packed objects are kept.
+func (s *DiskStore) Prune(keep func(hash string) bool, cutoff time.Time) (PruneResult, error) {
+	return s.Loose.Prune(keep, cutoff)
+}
@@ -0,0 +1,49 @@
+package objects
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPruneEvictsCachedObjects(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir(), FormatLit)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := WriteTree(store, map[string]TreeEntry{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pruned := WriteCommit(store, NewCommit("pruned", tree, time.Unix(1650000000, 0)))
+	kept := WriteCommit(store, NewCommit("kept", tree, time.Unix(1650000001, 0)))
+
+	for _, hash := range []string{pruned, kept} {
+		if _, err := ReadAsCommit(store, hash); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := store.Prune(func(hash string) bool {
+		return hash != pruned
+	}, time.Now().Add(time.Hour))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Objects != 1 {
+		t.Errorf("pruned %d objects, want 1", result.Objects)
+	}
+
+	if _, err := ReadAsCommit(store, pruned); err == nil {
+		t.Error("the pruned commit can still be read from the cache")
+	}
+
+	if _, err := ReadAsCommit(store, kept); err != nil {
+		t.Errorf("reading the kept commit: %v", err)
+	}
+}
@@ -0,0 +1,26 @@
+package objects
+
+import "errors"
+
+// ObjectStore is a storage backend for lit objects. Objects are addressed by
+// their lowercase hexadecimal hash and stored as opaque byte slices, so a
+// backend does not need to know anything about the object encoding.
+type ObjectStore interface {
+	// Put stores data under the given hash. Storing a hash that already
+	// exists is not an error.
+	Put(hash string, data []byte) error
+	// Get returns the data stored under the given hash, or ErrObjectNotFound.
+	Get(hash string) ([]byte, error)
+	// Has reports whether an object with the given hash is stored.
+	Has(hash string) (bool, error)
+	// Iterate calls f with the hash of every stored object. Iteration stops at
+	// the first error returned by f, which is then returned by Iterate.
+	Iterate(f func(hash string) error) error
+	// ResolvePrefix returns the hashes of every stored object starting with prefix.
+	ResolvePrefix(prefix string) ([]string, error)
+	// Format returns the format objects in the store are serialized and hashed with.
+	Format() Format
+}
+
+// ErrObjectNotFound is returned by an ObjectStore when the requested object does not exist.
+var ErrObjectNotFound = errors.New("object not found")
@@ -0,0 +1,356 @@
+package objects
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ObjectWriter writes the stored data of a single object, whose hash is only
+// known once all of it has been written.
+type ObjectWriter interface {
+	io.Writer
+	// Commit stores the written data under the given hash.
+	Commit(hash string) error
+	// Abort discards the written data.
+	Abort() error
+}
+
+// StreamStore is implemented by ObjectStores able to write and read stored
+// object data without holding it in memory. Objects in other stores are
+// buffered in memory when streamed.
+type StreamStore interface {
+	ObjectStore
+	// NewWriter returns a writer for the stored data of a new object.
+	NewWriter() (ObjectWriter, error)
+	// Open opens the stored data of the object with the given hash for
+	// reading, returning ErrObjectNotFound if it does not exist.
+	Open(hash string) (io.ReadCloser, error)
+}
+
+// bufferedWriter is the ObjectWriter of stores not implementing StreamStore.
+type bufferedWriter struct {
+	bytes.Buffer
+	store ObjectStore
+}
+
+func (w *bufferedWriter) Commit(hash string) error {
+	return w.store.Put(hash, w.Bytes())
+}
+
+func (w *bufferedWriter) Abort() error {
+	w.Reset()
+	return nil
+}
+
+// newObjectWriter returns a writer for the stored data of a new object in store.
+func newObjectWriter(store ObjectStore) (ObjectWriter, error) {
+	if streamStore, ok := store.(StreamStore); ok {
+		return streamStore.NewWriter()
+	}
+
+	return &bufferedWriter{store: store}, nil
+}
+
+// openStored opens the stored data of the object with the given hash.
+func openStored(store ObjectStore, hash string) (io.ReadCloser, error) {
+	if streamStore, ok := store.(StreamStore); ok {
+		return streamStore.Open(hash)
+	}
+
+	data, err := store.Get(hash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// ErrSizeChanged is returned by WriteBlobFrom when the reader does not
+// provide the announced amount of data, e.g. because a file changed while
+// being read.
+var ErrSizeChanged = errors.New("content size changed while reading")
+
+// WriteBlobFrom writes a blob with size bytes of content read from reader,
+// without holding the content in memory, and returns its hash.
+func WriteBlobFrom(store ObjectStore, reader io.Reader, size int64) (string, error) {
+	writer, err := newObjectWriter(store)
+
+	if err != nil {
+		return "", err
+	}
+
+	hash, err := writeBlobStream(writer, store.Format(), reader, size)
+
+	if err != nil {
+		writer.Abort()
+		return "", err
+	}
+
+	if err = writer.Commit(hash); err != nil {
+		return "", err
+	}
+
+	return hash, nil
+}
+
+// writeBlobStream compresses a blob into writer, returning its hash.
+func writeBlobStream(writer io.Writer, format Format, reader io.Reader, size int64) (string, error) {
+	compressor := zlib.NewWriter(writer)
+	hasher := format.NewHash(TypeBlob, size)
+
+	if _, err := compressor.Write([]byte(TypeBlob + " " + strconv.FormatInt(size, 10) + "\x00")); err != nil {
+		return "", err
+	}
+
+	written, err := io.Copy(io.MultiWriter(compressor, hasher), io.LimitReader(reader, size))
+
+	if err != nil {
+		return "", err
+	}
+
+	// the reader must end exactly after size bytes
+	if extra, _ := reader.Read(make([]byte, 1)); written != size || extra != 0 {
+		return "", ErrSizeChanged
+	}
+
+	if err = compressor.Close(); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// HashFile returns the hash Blobify gives the file at path, reading it
+// without holding it in memory.
+func HashFile(format Format, path string, chunkThreshold int64) (string, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
+
+	info, err := file.Stat()
+
+	if err != nil {
+		return "", err
+	}
+
+	if shouldChunk(info.Size(), chunkThreshold) {
+		return HashChunkedBlob(format, file)
+	}
+
+	hasher := format.NewHash(TypeBlob, info.Size())
+
+	if _, err = io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// verifyingReader reads the body of a blob, verifying its hash once the end is reached.
+type verifyingReader struct {
+	reader io.Reader
+	closer io.Closer
+	hasher hash.Hash
+	hash   string
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.hasher.Write(p[:n])
+
+	if err == io.EOF {
+		if actual := hex.EncodeToString(r.hasher.Sum(nil)); actual != r.hash {
+			return n, &CorruptObjectError{Hash: r.hash, Actual: actual}
+		}
+	}
+
+	return n, err
+}
+
+func (r *verifyingReader) Close() error {
+	return r.closer.Close()
+}
+
+// chunkReader reads the content of a chunked blob one chunk at a time.
+type chunkReader struct {
+	store   ObjectStore
+	chunks  []ChunkRef
+	current io.Reader
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.current != nil {
+			n, err := r.current.Read(p)
+
+			if err != io.EOF {
+				return n, err
+			}
+
+			r.current = nil
+
+			if n > 0 {
+				return n, nil
+			}
+		}
+
+		if len(r.chunks) == 0 {
+			return 0, io.EOF
+		}
+
+		data, err := readObject(r.store, r.chunks[0].Hash, TypeBlob)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if int64(len(data)) != r.chunks[0].Size {
+			return 0, &CorruptObjectError{Hash: r.chunks[0].Hash}
+		}
+
+		r.current = bytes.NewReader(data)
+		r.chunks = r.chunks[1:]
+	}
+}
+
+func (r *chunkReader) Close() error {
+	return nil
+}
+
+// maxManifestSize bounds the manifests read into memory by OpenBlob.
+const maxManifestSize = 64 << 20
+
+// OpenBlob opens the content of the blob with the given hash for reading,
+// reassembling chunked blobs, without holding the content in memory. The
+// content is verified against its hash while it is read, with Read returning
+// a *CorruptObjectError on mismatch.
+func OpenBlob(store ObjectStore, hash string) (io.ReadCloser, error) {
+	stored, err := openStored(store, hash)
+
+	if err != nil {
+		return nil, ErrCouldNotRead
+	}
+
+	buffered := bufio.NewReader(stored)
+
+	// objects written as JSON by older lit versions are small enough to decode in memory
+	if first, err := buffered.Peek(1); err == nil && first[0] == '{' {
+		defer stored.Close()
+
+		data, err := io.ReadAll(buffered)
+
+		if err != nil {
+			return nil, ErrCouldNotRead
+		}
+
+		blob, err := decodeStoredBlob(store, hash, data)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return io.NopCloser(bytes.NewReader(blob)), nil
+	}
+
+	decompressor, err := zlib.NewReader(buffered)
+
+	if err != nil {
+		stored.Close()
+		return nil, &CorruptObjectError{Hash: hash}
+	}
+
+	body := bufio.NewReader(decompressor)
+	objType, size, err := readHeader(body)
+
+	if err != nil {
+		stored.Close()
+		return nil, &CorruptObjectError{Hash: hash}
+	}
+
+	switch objType {
+	case TypeBlob:
+		return &verifyingReader{
+			reader: io.LimitReader(body, size),
+			closer: stored,
+			hasher: store.Format().NewHash(TypeBlob, size),
+			hash:   hash,
+		}, nil
+	case TypeChunked:
+		defer stored.Close()
+
+		if size > maxManifestSize {
+			return nil, &CorruptObjectError{Hash: hash}
+		}
+
+		manifest, err := io.ReadAll(io.LimitReader(body, size))
+
+		if err != nil || int64(len(manifest)) != size {
+			return nil, &CorruptObjectError{Hash: hash}
+		}
+
+		if err = verifyObject(store.Format(), hash, TypeChunked, manifest); err != nil {
+			return nil, err
+		}
+
+		chunks, err := decodeManifest(manifest)
+
+		if err != nil {
+			return nil, &CorruptObjectError{Hash: hash}
+		}
+
+		return &chunkReader{store: store, chunks: chunks}, nil
+	default:
+		stored.Close()
+		return nil, ErrNotOfType
+	}
+}
+
+// decodeStoredBlob decodes and verifies stored blob data held in memory.
+func decodeStoredBlob(store ObjectStore, hash string, data []byte) ([]byte, error) {
+	objType, body, err := DecodeObject(data)
+
+	if err != nil {
+		return nil, &CorruptObjectError{Hash: hash}
+	}
+
+	if objType != TypeBlob {
+		return nil, ErrNotOfType
+	}
+
+	if err = verifyObject(store.Format(), hash, objType, body); err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// readHeader reads the "<type> <length>\x00" header of uncompressed object data.
+func readHeader(reader *bufio.Reader) (string, int64, error) {
+	header, err := reader.ReadString(0)
+
+	if err != nil {
+		return "", 0, ErrMalformedObject
+	}
+
+	objType, length, found := strings.Cut(strings.TrimSuffix(header, "\x00"), " ")
+	size, err := strconv.ParseInt(length, 10, 64)
+
+	if !found || err != nil || size < 0 {
+		return "", 0, ErrMalformedObject
+	}
+
+	return objType, size, nil
+}
@@ -0,0 +1,39 @@
+package objects
+
+import "time"
+
+// Tag is an annotated tag, naming another object and recording who tagged
+// it, when and why. Lightweight tags are refs only and have no tag object.
+type Tag struct {
+	// Name is the name of the tag, without refs/tags/.
+	Name string
+	// Target is the hash of the tagged object and TargetType its type.
+	Target, TargetType string
+	// Tagger is the identity of the tag's creator in "Name <email>" form.
+	Tagger  string
+	Time    time.Time
+	Message string
+}
+
+func WriteTag(store ObjectStore, tag *Tag) (hash string) {
+	format := store.Format()
+	body := format.EncodeTag(tag)
+
+	return writeObject(store, format.HashObject(TypeTag, body), TypeTag, body)
+}
+
+func ReadAsTag(store ObjectStore, hash string) (*Tag, error) {
+	body, err := readObject(store, hash, TypeTag)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tag, err := store.Format().DecodeTag(body)
+
+	if err != nil {
+		return nil, ErrCouldNotRead
+	}
+
+	return tag, nil
+}
@@ -1,83 +1,61 @@
 package objects
 
-import (
-	"crypto/sha256"
-	"encoding/json"
-	"fmt"
-	"lit/util"
-	"os"
-)
-
 type TreeEntry struct {
 	ObjType string `json:"Type"`
 	Hash string
 }
 
-func HashTree(entries map[string]TreeEntry) string {
-	toHash := ""
-	for name, entry := range entries {
-		toHash += name + entry.ObjType + entry.Hash + "\n"
-	}
-
-	return fmt.Sprintf("%2x", sha256.Sum256([]byte(toHash)))
-}
-
-func TreeToJSON(entries map[string]TreeEntry) []byte {
-	data, err := json.MarshalIndent(map[string]any{
-		"Type": "Tree",
-		"Object": struct {
-			Entries map[string]TreeEntry
-		}{entries},
-	}, "", "\t")
+// WriteTree writes a tree with the given entries into the store and returns
+// its hash. Entries with a hash the store's format cannot hold fail with
+// ErrInvalidHash.
+func WriteTree(store ObjectStore, entries map[string]TreeEntry) (string, error) {
+	format := store.Format()
+	body, err := format.EncodeTree(entries)
 
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
-	return data
-}
-
-func WriteTree(entries map[string]TreeEntry) (hash string) {
-	hash = HashTree(entries)
+	hash := format.HashObject(TypeTree, body)
 
-	jsonTree := TreeToJSON(entries)
+	if err = store.Put(hash, EncodeObject(TypeTree, body)); err != nil {
+		return "", err
+	}
 
-	err := os.MkdirAll(".lit/objects/"+hash[:FolderCharacters], 0777)
+	return hash, nil
+}
 
-	if err != nil {
-		hash = ""
-		return
+func ReadAsTree(store ObjectStore, hash string) (map[string]TreeEntry, error) {
+	if cached, found := DefaultCache.get(store, hash); found {
+		if tree, isTree := cached.(map[string]TreeEntry); isTree {
+			return copyTree(tree), nil
+		}
 	}
 
-	err = os.WriteFile(GetHashPath(hash), jsonTree, 0777)
+	body, err := readObject(store, hash, TypeTree)
 
 	if err != nil {
-		hash = ""
+		return nil, err
 	}
 
-	return
-}
-
-func ReadAsTree(hash string) (map[string]TreeEntry, error) {
-	objectData := genericObject{}
-
-	err := util.ReadJSON(GetHashPath(hash), &objectData)
+	tree, err := store.Format().DecodeTree(body)
 
 	if err != nil {
 		return nil, ErrCouldNotRead
 	}
 
-	if objectData.ObjType != "Tree" {
-		return nil, ErrNotOfType
-	}
+	DefaultCache.add(store, hash, copyTree(tree))
+
+	return tree, nil
+}
 
-	entries := objectData.Obj["Entries"].(map[string]any)
-	result := map[string]TreeEntry{}
+// copyTree returns a copy of tree, so cached trees are not modified by callers.
+func copyTree(tree map[string]TreeEntry) map[string]TreeEntry {
+	result := make(map[string]TreeEntry, len(tree))
 
-	for name, entry := range entries {
-		entryAsMap := entry.(map[string]any)
-		result[name] = TreeEntry{Hash: entryAsMap["Hash"].(string), ObjType: entryAsMap["Type"].(string)}
+	for name, entry := range tree {
+		result[name] = entry
 	}
 
-	return result, nil
+	return result
 }
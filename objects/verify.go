@@ -0,0 +1,80 @@
+package objects
+
+import (
+	"bufio"
+	"compress/zlib"
+	"io"
+)
+
+// ReadType returns the type of the object with the given hash, only decoding
+// its header. The object is not verified.
+func ReadType(store ObjectStore, hash string) (string, error) {
+	stored, err := openStored(store, hash)
+
+	if err != nil {
+		return "", ErrCouldNotRead
+	}
+
+	defer stored.Close()
+
+	buffered := bufio.NewReader(stored)
+
+	if first, err := buffered.Peek(1); err == nil && first[0] == '{' {
+		data, err := io.ReadAll(buffered)
+
+		if err != nil {
+			return "", ErrCouldNotRead
+		}
+
+		objType, _, err := DecodeObject(data)
+
+		if err != nil {
+			return "", &CorruptObjectError{Hash: hash}
+		}
+
+		return objType, nil
+	}
+
+	decompressor, err := zlib.NewReader(buffered)
+
+	if err != nil {
+		return "", &CorruptObjectError{Hash: hash}
+	}
+
+	objType, _, err := readHeader(bufio.NewReader(decompressor))
+
+	if err != nil {
+		return "", &CorruptObjectError{Hash: hash}
+	}
+
+	return objType, nil
+}
+
+// Verify checks that the object with the given hash can be decoded and
+// matches its hash, returning its type. Blobs are verified without holding
+// them in memory. The chunks of chunked blobs are not verified.
+func Verify(store ObjectStore, hash string) (string, error) {
+	objType, err := ReadType(store, hash)
+
+	if err != nil {
+		return "", err
+	}
+
+	if objType != TypeBlob {
+		_, _, err = readAnyObject(store, hash)
+
+		return objType, err
+	}
+
+	blob, err := OpenBlob(store, hash)
+
+	if err != nil {
+		return objType, err
+	}
+
+	defer blob.Close()
+
+	_, err = io.Copy(io.Discard, blob)
+
+	return objType, err
+}
@@ -5,36 +5,121 @@ import (
 	"errors"
 	"lit/objects"
 	"lit/util"
+	"path/filepath"
 	"strings"
 )
 
-// HeadContent represents the JSON content of HEAD in struct form.
+// Store manipulates the refs kept in the lit directory of a single repository.
+type Store struct {
+	dir     string
+	objects objects.ObjectStore
+	// identity is recorded in the reflog entries of changes
+	identity string
+}
+
+// NewStore returns a Store for the refs in the lit directory dir, verifying
+// ref targets against the given object store.
+func NewStore(dir string, objectStore objects.ObjectStore) *Store {
+	return &Store{dir: dir, objects: objectStore}
+}
+
+// path returns the path of a file inside the lit directory.
+func (s *Store) path(elem ...string) string {
+	return filepath.Join(append([]string{s.dir}, elem...)...)
+}
+
+// HeadContent describes what HEAD points to. HEAD is stored like any other
+// ref, as a BranchContent which is symbolic unless HEAD is detached.
+// Repositories created before HEAD could point to any ref store HeadContent
+// itself, which is still read.
 type HeadContent struct {
-	// Detached specifies whether HEAD points to a commit (true) or a branch (false).
+	// Detached specifies whether HEAD points to a commit (true) or a ref (false).
 	Detached bool
-	// Location specifies the commit hash or branch name that HEAD points to.
+	// Location specifies the commit hash or branch name that HEAD points to,
+	// or the full name of the ref if it points to a ref outside refs/heads/.
 	Location string
 }
 
+// headContent returns what the stored content of HEAD points to.
+func headContent(content BranchContent) HeadContent {
+	if content.Symbolic == "" {
+		return HeadContent{Detached: content.Reference != "", Location: content.Reference}
+	}
+
+	if branch := strings.TrimPrefix(content.Symbolic, "refs/heads/"); branch != content.Symbolic {
+		return HeadContent{Detached: false, Location: branch}
+	}
+
+	return HeadContent{Detached: false, Location: content.Symbolic}
+}
+
+// content returns the stored content of HEAD pointing to hc.Location,
+// which is a branch name unless HEAD is detached.
+func (hc HeadContent) content() BranchContent {
+	if hc.Detached {
+		return BranchContent{Reference: hc.Location}
+	}
+
+	return BranchContent{Symbolic: "refs/heads/" + hc.Location}
+}
+
 var (
 	ErrCouldNotRead = errors.New("could not read")
 )
 
+// InitHead points HEAD to the given branch without checking that it exists,
+// as is needed for a freshly initialized repository.
+func (s *Store) InitHead(branch string) error {
+	return writeRef(s.path("HEAD"), HeadContent{Detached: false, Location: branch}.content())
+}
+
+// writeRef writes the JSON content of the ref file at path while holding its
+// lock, failing with util.ErrLocked if another process is updating it.
+func writeRef(path string, content any) error {
+	lock, err := util.LockFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer lock.Unlock()
+
+	return util.WriteJSON(path, content)
+}
+
+// readHead returns the stored content of HEAD, converting the HeadContent
+// stored by older repositories.
+func (s *Store) readHead() (BranchContent, error) {
+	var stored struct {
+		BranchContent
+		HeadContent
+	}
+
+	if err := util.ReadJSON(s.path("HEAD"), &stored); err != nil {
+		return BranchContent{}, err
+	}
+
+	if stored.Location != "" {
+		return stored.HeadContent.content(), nil
+	}
+
+	return stored.BranchContent, nil
+}
+
 // ReadHead reads the content of HEAD and returns it in a struct.
-func ReadHead() (HeadContent, error) {
-	var hc HeadContent
-	err := util.ReadJSON(".lit/HEAD", &hc)
+func (s *Store) ReadHead() (HeadContent, error) {
+	content, err := s.readHead()
 
 	if err != nil {
 		return HeadContent{}, ErrCouldNotRead
 	}
 
-	return hc, nil
+	return headContent(content), nil
 }
 
-// HeadCommit returns hash of commit pointed to by HEAD or by the current branch.
-func HeadCommit() (string, error) {
-	hc, err := ReadHead()
+// HeadCommit returns hash of commit pointed to by HEAD or by the ref it points to.
+func (s *Store) HeadCommit() (string, error) {
+	hc, err := s.ReadHead()
 
 	if err != nil {
 		return "", err
@@ -44,11 +129,7 @@ func HeadCommit() (string, error) {
 		return "", nil
 	}
 
-	if hc.Detached {
-		return hc.Location, nil
-	}
-
-	hash, err := ReadBranch(hc.Location)
+	_, hash, err := s.ResolveRef("HEAD")
 
 	if err != nil {
 		return "", err
@@ -57,8 +138,11 @@ func HeadCommit() (string, error) {
 	return hash, nil
 }
 
-func NudgeHead(commitHash string) error {
-	headContent, err := ReadHead()
+// NudgeHead moves HEAD, or the branch it points to, to the given commit,
+// recording reason in the reflogs of HEAD and the branch. The update fails
+// with a *RefMismatchError if another process moves it at the same time.
+func (s *Store) NudgeHead(commitHash string, reason string) error {
+	headContent, err := s.ReadHead()
 
 	if err != nil {
 		return err
@@ -68,87 +152,91 @@ func NudgeHead(commitHash string) error {
 		return nil
 	}
 
-	if headContent.Detached {
-		headContent.Location = commitHash
-		SetHeadTo(headContent)
-	} else {
-		exists, err := BranchExists(headContent.Location)
+	// an unborn branch has no commit, which is recorded as such
+	old, _ := s.HeadCommit()
 
-		if err != nil {
-			return err
-		}
+	t := s.NewTransaction()
+	t.UpdateFrom("HEAD", commitHash, old, reason)
 
-		if !exists {
-			err = CreateBranchTo(headContent.Location, commitHash)
+	return t.Commit()
+}
 
-			if err != nil {
-				return err
-			}
-		}
+// LockHead locks HEAD, failing with util.ErrLocked if another process is
+// updating it. It is held by operations that must not be interleaved with
+// other changes of HEAD, which then use SetHeadToLocked.
+func (s *Store) LockHead() (*util.Lock, error) {
+	return util.LockFile(s.path("HEAD"))
+}
 
-		err = SetBranchTo(headContent.Location, commitHash)
-
-		if err != nil {
-			return err
-		}
-	}
+// SetHeadTo sets HEAD to the specified content, checking for invalid
+// locations and returning ErrNotFound on failure. The change is recorded in
+// the reflog of HEAD with the given reason.
+func (s *Store) SetHeadTo(hc HeadContent, reason string) error {
+	lock, err := s.LockHead()
 
 	if err != nil {
 		return err
 	}
 
-	return nil
+	defer lock.Unlock()
+
+	return s.SetHeadToLocked(hc, reason)
 }
 
-// SetHeadTo sets HEAD to the specified content, checking for invalid locations and returning ErrCouldNotFind on failure.
-func SetHeadTo(hc HeadContent) error {
+// SetHeadToLocked is SetHeadTo for callers holding the lock of HEAD.
+func (s *Store) SetHeadToLocked(hc HeadContent, reason string) error {
 	// verify the location
 	if hc.Detached {
-		isCommit := objects.HashIsCommit(hc.Location)
+		isCommit := objects.HashIsCommit(s.objects, hc.Location)
 		if !isCommit {
 			return ErrNotFound
 		}
 	} else {
-		isBranch, err := BranchExists(hc.Location)
+		isBranch, err := s.BranchExists(hc.Location)
 
 		if err != nil || !isBranch {
 			return ErrNotFound
 		}
 	}
 
-	return util.WriteJSON(".lit/HEAD", hc)
+	// an unborn branch has no commit, which is recorded as such
+	old, _ := s.HeadCommit()
+
+	if err := util.WriteJSON(s.path("HEAD"), hc.content()); err != nil {
+		return err
+	}
+
+	new, _ := s.HeadCommit()
+
+	return s.appendReflog("HEAD", old, new, reason)
 }
 
 // ErrNotFound is a sentinel error for locations not found.
 var ErrNotFound = errors.New("could not find location")
 
 // SetHeadToString sets HEAD to a branch if location is a branch name, otherwise it sets it to a commit hash.
-func SetHeadToString(location string) error {
-	exists, err := BranchExists(location)
+func (s *Store) SetHeadToString(location string, reason string) error {
+	exists, err := s.BranchExists(location)
 
 	if err != nil {
 		return err
 	}
 
 	if exists {
-		SetHeadTo(HeadContent{Detached: false, Location: location})
-		return nil
+		return s.SetHeadTo(HeadContent{Detached: false, Location: location}, reason)
 	}
 
-	lowerLocation := strings.ToLower(location)
+	hash, err := objects.ResolveHashPrefix(s.objects, location)
 
-	// search commits for hash
-	hash, err := objects.ExpandHash(lowerLocation)
+	if errors.Is(err, objects.ErrUnknownHash) || errors.Is(err, objects.ErrInvalidHash) {
+		return ErrNotFound
+	}
 
 	if err != nil {
 		return err
 	}
 
-	if hash == "" {
-		return ErrNotFound
-	}
-
-	err = SetHeadTo(HeadContent{Detached: true, Location: hash})
+	err = s.SetHeadTo(HeadContent{Detached: true, Location: hash}, reason)
 
 	if err != nil {
 		return err
@@ -0,0 +1,151 @@
+package refs
+
+import (
+	"errors"
+	"lit/util"
+	"testing"
+)
+
+func readHeadFile(t *testing.T, s *Store) BranchContent {
+	var content BranchContent
+
+	if err := util.ReadJSON(s.path("HEAD"), &content); err != nil {
+		t.Fatal(err)
+	}
+
+	return content
+}
+
+func TestHeadIsStoredAsSymbolicRef(t *testing.T) {
+	s, commits := newTestStore(t)
+
+	if content := readHeadFile(t, s); content != (BranchContent{Symbolic: "refs/heads/main"}) {
+		t.Errorf("HEAD of a new store holds %+v", content)
+	}
+
+	updateRefs(t, s, map[string]string{"refs/heads/main": commits[0]})
+
+	if err := s.SetHeadTo(HeadContent{Detached: true, Location: commits[1]}, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if content := readHeadFile(t, s); content != (BranchContent{Reference: commits[1]}) {
+		t.Errorf("detached HEAD holds %+v", content)
+	}
+
+	// a detached HEAD is updated itself
+	if err := s.NudgeHead(commits[2], "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if content := readHeadFile(t, s); content != (BranchContent{Reference: commits[2]}) {
+		t.Errorf("HEAD holds %+v after moving the detached HEAD", content)
+	}
+
+	if err := s.SetHeadTo(HeadContent{Detached: false, Location: "main"}, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if content := readHeadFile(t, s); content != (BranchContent{Symbolic: "refs/heads/main"}) {
+		t.Errorf("HEAD holds %+v after checking out main", content)
+	}
+}
+
+func TestReadLegacyHead(t *testing.T) {
+	s, commits := newTestStore(t)
+	updateRefs(t, s, map[string]string{"refs/heads/main": commits[0]})
+
+	tests := []struct {
+		name   string
+		legacy HeadContent
+		// symbolic is the ref HEAD points to, hash what it resolves to
+		symbolic, hash string
+	}{
+		{"branch", HeadContent{Detached: false, Location: "main"}, "refs/heads/main", commits[0]},
+		{"detached", HeadContent{Detached: true, Location: commits[1]}, "", commits[1]},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := util.WriteJSON(s.path("HEAD"), test.legacy); err != nil {
+				t.Fatal(err)
+			}
+
+			if hc, err := s.ReadHead(); err != nil || hc != test.legacy {
+				t.Errorf("ReadHead() = %+v, %v, want %+v", hc, err, test.legacy)
+			}
+
+			if target, _ := s.ReadSymbolicRef("HEAD"); target != test.symbolic {
+				t.Errorf("HEAD points to %q, want %q", target, test.symbolic)
+			}
+
+			if _, hash, err := s.ResolveRef("HEAD"); err != nil || hash != test.hash {
+				t.Errorf("HEAD resolves to %q, %v, want %q", hash, err, test.hash)
+			}
+
+			// the next change of HEAD stores it as a symbolic ref
+			if err := s.SetSymbolicRef("HEAD", "refs/heads/main", "test"); err != nil {
+				t.Fatal(err)
+			}
+
+			if content := readHeadFile(t, s); content != (BranchContent{Symbolic: "refs/heads/main"}) {
+				t.Errorf("HEAD holds %+v after pointing it to main", content)
+			}
+		})
+	}
+}
+
+func TestHeadPointsOutsideBranches(t *testing.T) {
+	s, commits := newTestStore(t)
+	updateRefs(t, s, map[string]string{"refs/heads/main": commits[0], "refs/backup/main": commits[1]})
+
+	if err := s.SetSymbolicRef("HEAD", "refs/backup/main", "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if target, err := s.ReadSymbolicRef("HEAD"); err != nil || target != "refs/backup/main" {
+		t.Errorf("HEAD points to %q, %v, want refs/backup/main", target, err)
+	}
+
+	want := HeadContent{Detached: false, Location: "refs/backup/main"}
+
+	if hc, err := s.ReadHead(); err != nil || hc != want {
+		t.Errorf("ReadHead() = %+v, %v, want %+v", hc, err, want)
+	}
+
+	if hash, err := s.HeadCommit(); err != nil || hash != commits[1] {
+		t.Errorf("HeadCommit() = %q, %v, want %q", hash, err, commits[1])
+	}
+
+	// updates of HEAD move the ref it points to
+	if err := s.NudgeHead(commits[2], "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, hash, err := s.ResolveRef("refs/backup/main"); err != nil || hash != commits[2] {
+		t.Errorf("refs/backup/main resolves to %q, %v after moving HEAD, want %q", hash, err, commits[2])
+	}
+
+	if hash, _ := s.ReadBranch("main"); hash != commits[0] {
+		t.Errorf("main moved to %q", hash)
+	}
+
+	entries, err := s.Reflog("HEAD")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if last := entries[len(entries)-1]; last.Old != commits[1] || last.New != commits[2] {
+		t.Errorf("the last reflog entry of HEAD is %+v", last)
+	}
+
+	// no ref can point back to HEAD, nor can HEAD be deleted
+	if err := s.SetSymbolicRef("refs/backup/head", "HEAD", "test"); !errors.Is(err, ErrInvalidUpdate) {
+		t.Errorf("pointing a symbolic ref to HEAD returns %v, want ErrInvalidUpdate", err)
+	}
+
+	if err := s.DeleteSymbolicRef("HEAD"); !errors.Is(err, ErrInvalidUpdate) {
+		t.Errorf("deleting HEAD returns %v, want ErrInvalidUpdate", err)
+	}
+}
@@ -0,0 +1,224 @@
+package refs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"lit/util"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrInvalidRefName is matched by errors.Is for every *InvalidRefNameError.
+	ErrInvalidRefName = errors.New("invalid ref name")
+	// ErrRefConflict is matched by errors.Is for every *RefConflictError.
+	ErrRefConflict = errors.New("ref name conflict")
+)
+
+// InvalidRefNameError is returned when a branch or tag name breaks the ref
+// format rules checked by CheckRefName.
+type InvalidRefNameError struct {
+	Name   string
+	Reason string
+}
+
+func (e *InvalidRefNameError) Error() string {
+	return fmt.Sprintf("%v %q: %s", ErrInvalidRefName, e.Name, e.Reason)
+}
+
+func (e *InvalidRefNameError) Is(target error) bool {
+	return target == ErrInvalidRefName
+}
+
+// RefConflictError is returned when a ref cannot be created because its file
+// would be a directory of another ref or the other way round, as with the
+// branches feature and feature/x.
+type RefConflictError struct {
+	Name string
+	// Existing is the full name of a ref in the way.
+	Existing string
+}
+
+func (e *RefConflictError) Error() string {
+	return fmt.Sprintf("%v: %s cannot be created while %s exists", ErrRefConflict, e.Name, e.Existing)
+}
+
+func (e *RefConflictError) Is(target error) bool {
+	return target == ErrRefConflict
+}
+
+// CheckRefName checks that a branch or tag name follows the same rules as
+// git's ref names, so it can be stored as a path and used in revisions.
+// Names are made of components separated by slashes, as in feature/login.
+func CheckRefName(name string) error {
+	invalid := func(reason string) error {
+		return &InvalidRefNameError{name, reason}
+	}
+
+	switch {
+	case name == "":
+		return invalid("empty name")
+	case name == "@":
+		return invalid("@ stands for HEAD")
+	case strings.HasPrefix(name, "-"):
+		return invalid("starts with -")
+	case strings.HasSuffix(name, "."):
+		return invalid("ends with .")
+	case strings.Contains(name, ".."):
+		return invalid("contains ..")
+	case strings.Contains(name, "@{"):
+		return invalid("contains @{")
+	}
+
+	for _, c := range name {
+		if c < 0x20 || c == 0x7f {
+			return invalid("contains a control character")
+		}
+
+		if strings.ContainsRune(" ~^:?*[\\", c) {
+			return invalid(fmt.Sprintf("contains %q", c))
+		}
+	}
+
+	for _, component := range strings.Split(name, "/") {
+		switch {
+		case component == "":
+			return invalid("contains an empty component")
+		case strings.HasPrefix(component, "."):
+			return invalid("a component starts with .")
+		case strings.HasSuffix(component, ".lock"):
+			return invalid("a component ends with .lock")
+		}
+	}
+
+	return nil
+}
+
+// refFileExists reports whether a ref is stored at path. Directories of
+// nested refs are not refs, and neither is anything below a ref.
+func refFileExists(path string) (bool, error) {
+	info, err := os.Stat(path)
+
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return !info.IsDir(), nil
+}
+
+// refNames returns the names of the refs stored below dir, e.g. refs/heads,
+// relative to dir and slash-separated.
+func refNames(dir string) ([]string, error) {
+	names := []string{}
+
+	if isDir, err := util.IsDir(dir); err != nil || !isDir {
+		return names, nil
+	}
+
+	err := util.ForeachSubfile(dir, func(path string, d fs.DirEntry) error {
+		// skip lock files and files being written by other processes
+		if strings.HasSuffix(d.Name(), ".lock") || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+
+		name, err := filepath.Rel(dir, filepath.FromSlash(path))
+
+		if err != nil {
+			return err
+		}
+
+		names = append(names, filepath.ToSlash(name))
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+// checkConflict checks that the ref with the given full name can be created
+// without a ref of the same prefix being in the way. It changes nothing, as
+// it runs before the ref is known to be created.
+func (s *Store) checkConflict(ref string) error {
+	components := strings.Split(ref, "/")
+
+	// refs/<kind> itself is not a ref
+	for i := 3; i < len(components); i++ {
+		prefix := strings.Join(components[:i], "/")
+		exists, err := s.refExists(prefix)
+
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			return &RefConflictError{ref, prefix}
+		}
+	}
+
+	nested, err := s.listRefs(ref + "/")
+
+	if err != nil {
+		return err
+	}
+
+	if len(nested) > 0 {
+		return &RefConflictError{ref, ref + "/" + nested[0]}
+	}
+
+	return nil
+}
+
+// moveLogsInWay moves the reflogs of deleted refs that are in the way of the
+// reflog of the ref with the given full name aside, as the reflog of feature
+// is in the way of the one of feature/x. They are renamed to <name>~<time>,
+// which no ref can be named, and are still reflogs, so their commits can be
+// recovered until the entries expire. It must only be called once the ref
+// has been written, when no ref in the way can exist anymore.
+func (s *Store) moveLogsInWay(ref string) error {
+	components := strings.Split(ref, "/")
+
+	for i := 3; i < len(components); i++ {
+		prefix := strings.Join(components[:i], "/")
+
+		if exists, _ := refFileExists(s.logPath(prefix)); exists {
+			return s.moveLogAside(prefix)
+		}
+	}
+
+	if isDir, _ := util.IsDir(s.logPath(ref)); isDir {
+		return s.moveLogAside(ref)
+	}
+
+	return nil
+}
+
+// moveLogAside renames the reflog, or directory of reflogs, of the ref with
+// the given full name to <name>~<time>.
+func (s *Store) moveLogAside(ref string) error {
+	path := s.logPath(ref)
+
+	return os.Rename(path, fmt.Sprintf("%s~%d", path, time.Now().UnixNano()))
+}
+
+// removeEmptyParents removes the directories containing path that are left
+// empty, up to but not including stop.
+func removeEmptyParents(path string, stop string) {
+	for dir := filepath.Dir(path); dir != stop && strings.HasPrefix(dir, stop); dir = filepath.Dir(dir) {
+		// fails for directories that are not empty
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package refs
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"lit/util"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/*
+Refs are stored either loose, as a JSON file per ref below refs/, or packed,
+as a line in the packed-refs file of the lit directory, which holds many refs
+in one file sorted by name, in the same format as git:
+
+	# pack-refs with: sorted
+	<hash> refs/heads/main
+	<hash> refs/tags/v1
+
+A loose ref overrides a packed ref of the same name, so refs are updated by
+writing their loose file and only PackRefs and deletions rewrite packed-refs.
+*/
+
+// ErrMalformedPackedRefs is returned when the packed-refs file cannot be parsed.
+var ErrMalformedPackedRefs = errors.New("malformed packed-refs")
+
+const packedRefsHeader = "# pack-refs with: sorted\n"
+
+// refPath returns the path of the loose file storing the ref with the given full name.
+func (s *Store) refPath(ref string) string {
+	return s.path(filepath.FromSlash(ref))
+}
+
+// readPackedRefs returns the hash of every packed ref by full name.
+func (s *Store) readPackedRefs() (map[string]string, error) {
+	packed := map[string]string{}
+	file, err := os.Open(s.path("packed-refs"))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return packed, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		hash, ref, found := strings.Cut(line, " ")
+
+		if !found || hash == "" || !strings.HasPrefix(ref, "refs/") {
+			return nil, fmt.Errorf("%w: %q", ErrMalformedPackedRefs, line)
+		}
+
+		packed[ref] = hash
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return packed, nil
+}
+
+// writePackedRefs replaces the packed refs. The caller must hold the lock of packed-refs.
+func (s *Store) writePackedRefs(packed map[string]string) error {
+	return util.WriteFileAtomic(s.path("packed-refs"), packedRefsContent(packed), 0644)
+}
+
+// packedRefsContent returns the content of a packed-refs file holding the given refs.
+func packedRefsContent(packed map[string]string) []byte {
+	names := make([]string, 0, len(packed))
+
+	for ref := range packed {
+		names = append(names, ref)
+	}
+
+	sort.Strings(names)
+
+	var content strings.Builder
+	content.WriteString(packedRefsHeader)
+
+	for _, ref := range names {
+		content.WriteString(packed[ref] + " " + ref + "\n")
+	}
+
+	return []byte(content.String())
+}
+
+// refExists reports whether the ref with the given full name exists, loose or packed.
+func (s *Store) refExists(ref string) (bool, error) {
+	exists, err := refFileExists(s.refPath(ref))
+
+	if err != nil || exists {
+		return exists, err
+	}
+
+	packed, err := s.readPackedRefs()
+
+	if err != nil {
+		return false, err
+	}
+
+	_, exists = packed[ref]
+
+	return exists, nil
+}
+
+// readRefContent returns the content of the ref with the given full name,
+// preferring its loose file over its packed entry, without following it if
+// it is symbolic. HEAD is symbolic unless it is detached.
+func (s *Store) readRefContent(ref string) (BranchContent, error) {
+	var content BranchContent
+
+	if ref == "HEAD" {
+		content, err := s.readHead()
+
+		if err != nil {
+			return content, ErrCouldNotRead
+		}
+
+		if content == (BranchContent{}) {
+			return content, ErrNotFound
+		}
+
+		return content, nil
+	}
+
+	data, err := os.ReadFile(s.refPath(ref))
+
+	if err == nil {
+		err = json.Unmarshal(data, &content)
+
+		return content, err
+	}
+
+	if exists, _ := refFileExists(s.refPath(ref)); exists {
+		return content, err
+	}
+
+	packed, err := s.readPackedRefs()
+
+	if err != nil {
+		return content, err
+	}
+
+	hash, exists := packed[ref]
+
+	if !exists {
+		return content, ErrNotFound
+	}
+
+	content.Reference = hash
+
+	return content, nil
+}
+
+// readRef returns the hash the ref with the given full name points to,
+// following symbolic refs.
+func (s *Store) readRef(ref string) (string, error) {
+	_, hash, err := s.ResolveRef(ref)
+
+	return hash, err
+}
+
+// removeRef deletes the ref with the given full name, loose and packed,
+// returning ErrNotFound if it doesn't exist. The caller must hold the lock
+// of the ref. The packed entry is removed first, as the ref would fall back
+// to it if only its loose file was removed.
+func (s *Store) removeRef(ref string) error {
+	loose, err := refFileExists(s.refPath(ref))
+
+	if err != nil {
+		return err
+	}
+
+	packed, err := s.readPackedRefs()
+
+	if err != nil {
+		return err
+	}
+
+	_, isPacked := packed[ref]
+
+	if !loose && !isPacked {
+		return ErrNotFound
+	}
+
+	if isPacked {
+		lock, err := util.LockFile(s.path("packed-refs"))
+
+		if err != nil {
+			return err
+		}
+
+		defer lock.Unlock()
+
+		if err = s.deletePacked([]string{ref}); err != nil {
+			return err
+		}
+	}
+
+	if loose {
+		return os.Remove(s.refPath(ref))
+	}
+
+	return nil
+}
+
+// listRefs returns the names of the refs whose full names start with
+// prefix, loose or packed, with the prefix removed and sorted by name.
+func (s *Store) listRefs(prefix string) ([]string, error) {
+	names, err := refNames(s.refPath(prefix))
+
+	if err != nil {
+		return nil, err
+	}
+
+	packed, err := s.readPackedRefs()
+
+	if err != nil {
+		return nil, err
+	}
+
+	listed := map[string]bool{}
+
+	for _, name := range names {
+		listed[name] = true
+	}
+
+	for ref := range packed {
+		if name := strings.TrimPrefix(ref, prefix); name != ref && !listed[name] {
+			names = append(names, name)
+			listed[name] = true
+		}
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// ListRefs returns the full names of every ref below refs/, loose or
+// packed, sorted by name. Besides branches and tags, these include refs
+// created by update-ref and symbolic-ref, such as refs/backup/main.
+func (s *Store) ListRefs() ([]string, error) {
+	names, err := s.listRefs("refs/")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, name := range names {
+		names[i] = "refs/" + name
+	}
+
+	return names, nil
+}
+
+// PackRefs moves every loose branch and tag into packed-refs, returning the
+// number of refs packed. Symbolic refs and refs locked by another process
+// are left loose.
+func (s *Store) PackRefs() (int, error) {
+	lock, err := util.LockFile(s.path("packed-refs"))
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer lock.Unlock()
+
+	packed, err := s.readPackedRefs()
+
+	if err != nil {
+		return 0, err
+	}
+
+	loose := []string{}
+
+	for _, prefix := range []string{"refs/heads/", "refs/tags/"} {
+		names, err := refNames(s.refPath(prefix))
+
+		if err != nil {
+			return 0, err
+		}
+
+		for _, name := range names {
+			loose = append(loose, prefix+name)
+		}
+	}
+
+	locks := []*util.Lock{}
+
+	defer func() {
+		for _, refLock := range locks {
+			refLock.Unlock()
+		}
+	}()
+
+	packedLoose := []string{}
+
+	for _, ref := range loose {
+		refLock, err := util.LockFile(s.refPath(ref))
+
+		if errors.Is(err, util.ErrLocked) {
+			continue
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		locks = append(locks, refLock)
+		content, err := s.readRefContent(ref)
+
+		if err != nil {
+			return 0, err
+		}
+
+		// symbolic refs can only be stored loose
+		if content.Symbolic != "" {
+			continue
+		}
+
+		hash := content.Reference
+
+		packed[ref] = hash
+		packedLoose = append(packedLoose, ref)
+	}
+
+	if err = s.writePackedRefs(packed); err != nil {
+		return 0, err
+	}
+
+	// the loose files are only removed once their refs are safely packed
+	for _, ref := range packedLoose {
+		if err = os.Remove(s.refPath(ref)); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, refLock := range locks {
+		refLock.Unlock()
+	}
+
+	locks = nil
+
+	for _, ref := range packedLoose {
+		// keeps refs/heads and refs/tags
+		kind := strings.SplitN(ref, "/", 3)[1]
+		removeEmptyParents(s.refPath(ref), s.path("refs", kind))
+	}
+
+	return len(packedLoose), nil
+}
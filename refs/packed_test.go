@@ -0,0 +1,263 @@
+package refs
+
+import (
+	"errors"
+	"lit/util"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// updateRefs points every ref in refs to its hash in a single transaction.
+func updateRefs(t *testing.T, s *Store, refs map[string]string) {
+	transaction := s.NewTransaction()
+
+	for ref, hash := range refs {
+		transaction.Update(ref, hash, "test")
+	}
+
+	if err := transaction.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func packRefs(t *testing.T, s *Store) int {
+	count, err := s.PackRefs()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return count
+}
+
+func readPacked(t *testing.T, s *Store) map[string]string {
+	packed, err := s.readPackedRefs()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return packed
+}
+
+func isLoose(t *testing.T, s *Store, ref string) bool {
+	exists, err := refFileExists(s.refPath(ref))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return exists
+}
+
+func TestLooseRefOverridesPackedRef(t *testing.T) {
+	s, commits := newTestStore(t)
+	updateRefs(t, s, map[string]string{"refs/heads/main": commits[0], "refs/tags/v1": commits[0]})
+
+	if count := packRefs(t, s); count != 2 {
+		t.Fatalf("packed %d refs, want 2", count)
+	}
+
+	if isLoose(t, s, "refs/heads/main") {
+		t.Fatal("refs/heads/main is still loose after packing")
+	}
+
+	if err := s.SetBranchTo("main", commits[1], "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !isLoose(t, s, "refs/heads/main") {
+		t.Fatal("updating a packed ref didn't write a loose file")
+	}
+
+	if packed := readPacked(t, s); packed["refs/heads/main"] != commits[0] {
+		t.Errorf("packed refs/heads/main is %q, want it unchanged", packed["refs/heads/main"])
+	}
+
+	for ref, want := range map[string]string{"refs/heads/main": commits[1], "refs/tags/v1": commits[0], "HEAD": commits[1]} {
+		if _, hash, err := s.ResolveRef(ref); err != nil || hash != want {
+			t.Errorf("%s resolves to %q, %v, want %q", ref, hash, err, want)
+		}
+	}
+}
+
+func TestListRefsMergesLooseAndPackedRefs(t *testing.T) {
+	s, commits := newTestStore(t)
+	updateRefs(t, s, map[string]string{
+		"refs/heads/main":      commits[0],
+		"refs/heads/feature/a": commits[0],
+		"refs/tags/v1":         commits[0],
+	})
+	packRefs(t, s)
+
+	// loose only, and both loose and packed
+	updateRefs(t, s, map[string]string{
+		"refs/heads/loose":   commits[1],
+		"refs/heads/main":    commits[1],
+		"refs/backup/main":   commits[2],
+		"refs/tags/v1":       commits[1],
+		"refs/heads/zz/last": commits[2],
+	})
+
+	names, err := s.ListRefs()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"refs/backup/main",
+		"refs/heads/feature/a",
+		"refs/heads/loose",
+		"refs/heads/main",
+		"refs/heads/zz/last",
+		"refs/tags/v1",
+	}
+
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("ListRefs() = %v, want %v", names, want)
+	}
+
+	branches, err := s.listRefs("refs/heads/")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"feature/a", "loose", "main", "zz/last"}; !reflect.DeepEqual(branches, want) {
+		t.Errorf("listRefs(\"refs/heads/\") = %v, want %v", branches, want)
+	}
+}
+
+func TestRemoveRef(t *testing.T) {
+	s, commits := newTestStore(t)
+	updateRefs(t, s, map[string]string{"refs/heads/both": commits[0], "refs/heads/packed": commits[0]})
+	packRefs(t, s)
+	updateRefs(t, s, map[string]string{"refs/heads/both": commits[1], "refs/heads/loose": commits[1]})
+
+	remove := func(ref string) error {
+		lock, err := util.LockFile(s.refPath(ref))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer lock.Unlock()
+
+		return s.removeRef(ref)
+	}
+
+	for _, ref := range []string{"refs/heads/both", "refs/heads/packed", "refs/heads/loose"} {
+		if err := remove(ref); err != nil {
+			t.Fatalf("removing %s: %v", ref, err)
+		}
+
+		// the ref must not fall back to its packed entry
+		if _, hash, err := s.ResolveRef(ref); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s resolves to %q, %v after removing it", ref, hash, err)
+		}
+
+		if isLoose(t, s, ref) {
+			t.Errorf("the loose file of %s was kept", ref)
+		}
+
+		if _, found := readPacked(t, s)[ref]; found {
+			t.Errorf("the packed entry of %s was kept", ref)
+		}
+	}
+
+	if err := remove("refs/heads/missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("removing a missing ref returns %v, want ErrNotFound", err)
+	}
+}
+
+func TestPackRefsSkipsSymbolicAndLockedRefs(t *testing.T) {
+	s, commits := newTestStore(t)
+	updateRefs(t, s, map[string]string{
+		"refs/heads/main":   commits[0],
+		"refs/heads/locked": commits[1],
+		"refs/tags/v1":      commits[2],
+		"refs/backup/main":  commits[0],
+	})
+
+	if err := s.SetSymbolicRef("refs/heads/alias", "refs/heads/main", "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := util.LockFile(s.refPath("refs/heads/locked"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer lock.Unlock()
+
+	if count := packRefs(t, s); count != 2 {
+		t.Errorf("packed %d refs, want main and v1", count)
+	}
+
+	want := map[string]string{"refs/heads/main": commits[0], "refs/tags/v1": commits[2]}
+
+	if packed := readPacked(t, s); !reflect.DeepEqual(packed, want) {
+		t.Errorf("packed refs are %v, want %v", packed, want)
+	}
+
+	// only branches and tags are packed
+	for _, ref := range []string{"refs/heads/alias", "refs/heads/locked", "refs/backup/main"} {
+		if !isLoose(t, s, ref) {
+			t.Errorf("%s is not loose anymore", ref)
+		}
+	}
+
+	if target, err := s.ReadSymbolicRef("refs/heads/alias"); err != nil || target != "refs/heads/main" {
+		t.Errorf("refs/heads/alias points to %q, %v, want refs/heads/main", target, err)
+	}
+
+	if _, hash, err := s.ResolveRef("refs/heads/alias"); err != nil || hash != commits[0] {
+		t.Errorf("refs/heads/alias resolves to %q, %v, want the packed main", hash, err)
+	}
+}
+
+func TestMalformedPackedRefs(t *testing.T) {
+	s, commits := newTestStore(t)
+
+	lines := map[string]string{
+		"no separator": "nohash",
+		"no hash":      " refs/heads/main",
+		"not a ref":    commits[0] + " heads/main",
+	}
+
+	for name, line := range lines {
+		t.Run(name, func(t *testing.T) {
+			content := packedRefsHeader + "\n" + commits[1] + " refs/tags/v1\n" + line + "\n"
+
+			if err := os.WriteFile(s.path("packed-refs"), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, _, err := s.ResolveRef("refs/tags/v1"); !errors.Is(err, ErrMalformedPackedRefs) {
+				t.Errorf("ResolveRef returns %v, want ErrMalformedPackedRefs", err)
+			}
+
+			if _, err := s.ListRefs(); !errors.Is(err, ErrMalformedPackedRefs) {
+				t.Errorf("ListRefs returns %v, want ErrMalformedPackedRefs", err)
+			}
+
+			if _, err := s.PackRefs(); !errors.Is(err, ErrMalformedPackedRefs) {
+				t.Errorf("PackRefs returns %v, want ErrMalformedPackedRefs", err)
+			}
+		})
+	}
+
+	// comments and blank lines are skipped
+	content := packedRefsHeader + "# comment\n\n" + commits[1] + " refs/tags/v1\n"
+
+	if err := os.WriteFile(s.path("packed-refs"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, hash, err := s.ResolveRef("refs/tags/v1"); err != nil || hash != commits[1] {
+		t.Errorf("refs/tags/v1 resolves to %q, %v, want %q", hash, err, commits[1])
+	}
+}
@@ -0,0 +1,310 @@
+package refs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"lit/util"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+The reflog of a ref records every change of the commit it points to, one line
+per change appended to logs/<ref> in the lit directory (e.g. logs/HEAD or
+logs/refs/heads/main), in the same format as git:
+
+	<old hash> <new hash> <identity> <unix time> <timezone>\t<reason>
+
+A hash of zeros stands for no commit, e.g. before a branch is created.
+*/
+
+// ReflogEntry is a change of a ref recorded in its reflog.
+type ReflogEntry struct {
+	// Old and New are the commits the ref pointed to before and after the change, empty for none.
+	Old, New string
+	// Identity is the "Name <email>" identity of the user who made the change.
+	Identity string
+	Time     time.Time
+	// Reason describes the change, e.g. "commit: message" or "checkout: moving from a to b".
+	Reason string
+}
+
+// ErrMalformedReflog is returned when a reflog line cannot be parsed.
+var ErrMalformedReflog = errors.New("malformed reflog")
+
+// FullRefName converts a branch name into the full name of its ref, leaving
+// HEAD and names starting with refs/ unchanged.
+func FullRefName(name string) string {
+	if name == "HEAD" || strings.HasPrefix(name, "refs/") {
+		return name
+	}
+
+	return "refs/heads/" + name
+}
+
+// SetIdentity sets the identity recorded in reflog entries of changes made through the store.
+func (s *Store) SetIdentity(identity string) {
+	s.identity = identity
+}
+
+// logPath returns the path of the reflog of the ref with the given full name.
+func (s *Store) logPath(ref string) string {
+	return s.path("logs", filepath.FromSlash(ref))
+}
+
+// zeroHash returns the hash of zeros standing for no commit in place of a hash like other.
+func zeroHash(other string) string {
+	if other == "" {
+		other = strings.Repeat("0", 64)
+	}
+
+	return strings.Repeat("0", len(other))
+}
+
+// isZeroHash reports whether hash only consists of zeros.
+func isZeroHash(hash string) bool {
+	return strings.Trim(hash, "0") == ""
+}
+
+// appendReflog records a change of the ref with the given full name from old
+// to new in its reflog. The caller must hold the lock of the ref.
+func (s *Store) appendReflog(ref string, old string, new string, reason string) error {
+	if old == "" {
+		old = zeroHash(new)
+	}
+
+	if new == "" {
+		new = zeroHash(old)
+	}
+
+	// a reason spanning several lines would break the format
+	reason, _, _ = strings.Cut(reason, "\n")
+	now := time.Now()
+	line := fmt.Sprintf("%s %s %s %d %s\t%s\n", old, new, s.identity, now.Unix(), now.Format("-0700"), reason)
+
+	if err := s.moveLogsInWay(ref); err != nil {
+		return err
+	}
+
+	path := s.logPath(ref)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = file.WriteString(line); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// parseReflogEntry parses a line of a reflog without its line break.
+func parseReflogEntry(line string) (ReflogEntry, error) {
+	entry := ReflogEntry{}
+	fields, reason, found := strings.Cut(line, "\t")
+
+	if !found {
+		return entry, ErrMalformedReflog
+	}
+
+	entry.Reason = reason
+
+	hashes := strings.SplitN(fields, " ", 3)
+
+	if len(hashes) != 3 {
+		return entry, ErrMalformedReflog
+	}
+
+	entry.Old, entry.New = hashes[0], hashes[1]
+
+	if isZeroHash(entry.Old) {
+		entry.Old = ""
+	}
+
+	if isZeroHash(entry.New) {
+		entry.New = ""
+	}
+
+	// the identity may contain spaces, unlike the time and timezone after it
+	rest := strings.Split(hashes[2], " ")
+
+	if len(rest) < 2 {
+		return entry, ErrMalformedReflog
+	}
+
+	unix, err := strconv.ParseInt(rest[len(rest)-2], 10, 64)
+
+	if err != nil {
+		return entry, ErrMalformedReflog
+	}
+
+	zone, err := time.Parse("-0700", rest[len(rest)-1])
+
+	if err != nil {
+		return entry, ErrMalformedReflog
+	}
+
+	entry.Identity = strings.Join(rest[:len(rest)-2], " ")
+	entry.Time = time.Unix(unix, 0).In(zone.Location())
+
+	return entry, nil
+}
+
+// Reflog returns the entries of the reflog of the ref with the given full
+// name, oldest first. Refs without a reflog have no entries.
+func (s *Store) Reflog(ref string) ([]ReflogEntry, error) {
+	file, err := os.Open(s.logPath(ref))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return []ReflogEntry{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	entries := []ReflogEntry{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+
+		entry, err := parseReflogEntry(scanner.Text())
+
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// ReflogRefs returns the full names of every ref that has a reflog.
+func (s *Store) ReflogRefs() ([]string, error) {
+	refs := []string{}
+	logs := s.path("logs")
+
+	if isDir, err := util.IsDir(logs); err != nil || !isDir {
+		return refs, nil
+	}
+
+	err := filepath.WalkDir(logs, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || strings.HasSuffix(d.Name(), ".lock") || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+
+		relative, err := filepath.Rel(logs, path)
+
+		if err != nil {
+			return err
+		}
+
+		refs = append(refs, filepath.ToSlash(relative))
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
+
+// ExpireReflogs removes the reflog entries older than cutoff from every
+// reflog, returning the number of entries removed.
+func (s *Store) ExpireReflogs(cutoff time.Time) (int, error) {
+	refs, err := s.ReflogRefs()
+
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+
+	for _, ref := range refs {
+		count, err := s.expireReflog(ref, cutoff)
+
+		if err != nil {
+			return expired, err
+		}
+
+		expired += count
+	}
+
+	return expired, nil
+}
+
+// expireReflog removes the entries older than cutoff from the reflog of the
+// ref with the given full name, returning the number of entries removed.
+func (s *Store) expireReflog(ref string, cutoff time.Time) (int, error) {
+	lock, err := util.LockFile(s.path(filepath.FromSlash(ref)))
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer lock.Unlock()
+
+	data, err := os.ReadFile(s.logPath(ref))
+
+	if err != nil {
+		return 0, err
+	}
+
+	var kept strings.Builder
+	expired := 0
+
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		entry, err := parseReflogEntry(strings.TrimSuffix(line, "\n"))
+
+		if err != nil {
+			return 0, err
+		}
+
+		if entry.Time.Before(cutoff) {
+			expired++
+			continue
+		}
+
+		kept.WriteString(line)
+	}
+
+	if expired == 0 {
+		return 0, nil
+	}
+
+	return expired, util.WriteFileAtomic(s.logPath(ref), []byte(kept.String()), 0644)
+}
@@ -3,65 +3,103 @@
 package refs
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
 	"lit/objects"
 	"lit/util"
 	"os"
+	"path/filepath"
 )
 
-// BranchExists checks if a branch exists with the given name, returning
-// an error if os.Stat fails.
-func BranchExists(name string) (bool, error) {
-	_, err := os.Stat(".lit/refs/heads/" + name)
+// branchPath returns the path of the file storing the given branch.
+func (s *Store) branchPath(name string) string {
+	return s.path("refs", "heads", filepath.FromSlash(name))
+}
 
-	if err == nil {
-		return true, nil
-	}
+// BranchExists checks if a branch exists with the given name, loose or
+// packed, returning an error if it cannot be checked.
+func (s *Store) BranchExists(name string) (bool, error) {
+	exists, err := s.refExists("refs/heads/" + name)
 
-	if errors.Is(err, fs.ErrNotExist) {
-		return false, nil
+	if err != nil {
+		return false, errors.New("failed to check if branch exists")
 	}
 
-	return false, errors.New("failed to check if branch exists")
+	return exists, nil
 }
 
-// CreateBranchTo creates a branch with a given name to a given commit hash.
-func CreateBranchTo(name string, hash string) error {
-	exists, err := BranchExists(name)
+// CreateBranchTo creates a branch with a given name to a given commit hash,
+// recording reason in its reflog. Names may contain slashes, as in
+// feature/login, but no branch may be named like a directory of another.
+func (s *Store) CreateBranchTo(name string, hash string, reason string) error {
+	if err := CheckRefName(name); err != nil {
+		return err
+	}
+
+	if err := s.checkConflict("refs/heads/" + name); err != nil {
+		return err
+	}
+
+	lock, err := util.LockFile(s.branchPath(name))
+
+	if err != nil {
+		return err
+	}
+
+	defer lock.Unlock()
+
+	exists, err := s.BranchExists(name)
 
 	if err != nil {
 		return err
 	}
 
 	if exists {
-		return errors.New("branch already exists")
+		return ErrBranchExists
 	}
 
-	isCommit := objects.HashIsCommit(hash)
+	isCommit := objects.HashIsCommit(s.objects, hash)
 
 	if !isCommit {
 		return fmt.Errorf("%s is not the hash of a commit", hash)
 	}
 
-	err = util.WriteJSON(".lit/refs/heads/"+name, BranchContent{hash})
+	err = util.WriteJSON(s.branchPath(name), BranchContent{Reference: hash})
 
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return s.appendReflog("refs/heads/"+name, "", hash, reason)
 }
 
-func SetBranchTo(name string, hash string) error {
-	return util.WriteJSON(".lit/refs/heads/"+name, BranchContent{hash})
+// SetBranchTo points the branch with the given name to a commit hash,
+// recording reason in its reflog, whatever it pointed to before. Use a
+// Transaction to only move it from an expected commit.
+func (s *Store) SetBranchTo(name string, hash string, reason string) error {
+	t := s.NewTransaction()
+	t.Update("refs/heads/"+name, hash, reason)
+
+	return t.Commit()
 }
 
-// DeleteBranch deletes a branch, returning an error if the branch doesn't exist.
-func DeleteBranch(name string) error {
-	exists, err := BranchExists(name)
+// DeleteBranch deletes a branch, returning an error if the branch doesn't
+// exist. The reflog of the branch is kept with a last entry recording the
+// deletion, so its commits can still be recovered until the entries expire.
+func (s *Store) DeleteBranch(name string) error {
+	// runs after the lock file is removed from the directory
+	defer removeEmptyParents(s.branchPath(name), s.path("refs", "heads"))
+
+	lock, err := util.LockFile(s.branchPath(name))
+
+	if err != nil {
+		return err
+	}
+
+	defer lock.Unlock()
+
+	exists, err := s.BranchExists(name)
 
 	if err != nil {
 		return err
@@ -71,89 +109,195 @@ func DeleteBranch(name string) error {
 		return ErrNotFound
 	}
 
-	err = os.Remove(".lit/refs/heads/" + name)
+	old, _ := s.ReadBranch(name)
 
-	if err != nil {
+	if err = s.removeRef("refs/heads/" + name); err != nil {
 		return err
 	}
 
-	return nil
+	return s.appendReflog("refs/heads/"+name, old, "", "branch: deleted")
 }
 
-func DeleteBranchSafe(name string) error {
-	hc, err := ReadHead()
+// ErrBranchExists is returned when a branch is created under the name of an existing branch.
+var ErrBranchExists = errors.New("branch already exists")
 
-	if err != nil {
+// RenameBranch renames a branch together with its reflog, pointing HEAD to
+// the new name if it pointed to the old one.
+func (s *Store) RenameBranch(old string, new string) error {
+	return s.copyBranch(old, new, true)
+}
+
+// CopyBranch creates a branch pointing to the same commit as another one,
+// starting with a copy of its reflog.
+func (s *Store) CopyBranch(old string, new string) error {
+	return s.copyBranch(old, new, false)
+}
+
+// copyBranch copies the branch old to new, deleting old if move is set.
+func (s *Store) copyBranch(old string, new string, move bool) error {
+	if err := CheckRefName(new); err != nil {
 		return err
 	}
 
-	if !hc.Detached && hc.Location == name {
-		loc, err := HeadCommit()
+	if err := s.checkConflict("refs/heads/" + new); err != nil {
+		return err
+	}
+
+	if old == new {
+		return ErrBranchExists
+	}
+
+	if move {
+		// runs after the lock file is removed from the directory
+		defer removeEmptyParents(s.branchPath(old), s.path("refs", "heads"))
+	}
+
+	for _, name := range []string{old, new} {
+		lock, err := util.LockFile(s.branchPath(name))
 
 		if err != nil {
 			return err
 		}
 
-		SetHeadTo(HeadContent{Detached: true, Location: loc})
+		defer lock.Unlock()
 	}
 
-	err = DeleteBranch(name)
+	hash, err := s.ReadBranch(old)
 
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
+	exists, err := s.BranchExists(new)
 
-type BranchContent struct {
-	Reference string
-}
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return ErrBranchExists
+	}
+
+	if err = util.WriteJSON(s.branchPath(new), BranchContent{Reference: hash}); err != nil {
+		return err
+	}
+
+	oldLog, newLog := s.logPath("refs/heads/"+old), s.logPath("refs/heads/"+new)
+	reason := "branch: copied refs/heads/" + old + " to refs/heads/" + new
+
+	// the reflog of a deleted branch named new is kept rather than overwritten
+	if exists, _ := refFileExists(newLog); exists {
+		err = s.moveLogAside("refs/heads/" + new)
+	} else {
+		err = s.moveLogsInWay("refs/heads/" + new)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(newLog), 0777); err != nil {
+		return err
+	}
+
+	if move {
+		reason = "branch: renamed refs/heads/" + old + " to refs/heads/" + new
+		err = os.Rename(oldLog, newLog)
+	} else if data, readErr := os.ReadFile(oldLog); readErr == nil {
+		err = util.WriteFileAtomic(newLog, data, 0644)
+	}
+
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if err = s.appendReflog("refs/heads/"+new, hash, hash, reason); err != nil {
+		return err
+	}
+
+	if !move {
+		return nil
+	}
+
+	if err = s.removeRef("refs/heads/" + old); err != nil {
+		return err
+	}
+
+	removeEmptyParents(oldLog, s.path("logs", "refs", "heads"))
+
+	hc, err := s.ReadHead()
+
+	if err != nil || hc.Detached || hc.Location != old {
+		return err
+	}
 
-func ReadBranch(name string) (string, error) {
-	exists, err := BranchExists(name)
+	lock, err := util.LockFile(s.path("HEAD"))
 
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	if !exists {
-		return "", ErrNotFound
+	defer lock.Unlock()
+
+	if err = util.WriteJSON(s.path("HEAD"), HeadContent{Detached: false, Location: new}.content()); err != nil {
+		return err
 	}
 
-	data, err := os.ReadFile(".lit/refs/heads/" + name)
+	return s.appendReflog("HEAD", hash, hash, reason)
+}
+
+func (s *Store) DeleteBranchSafe(name string) error {
+	hc, err := s.ReadHead()
 
 	if err != nil {
-		if err == os.ErrNotExist {
-			return "", ErrNotFound
-		}
-		
-		return "", err
+		return err
 	}
 
-	var content BranchContent
+	if !hc.Detached && hc.Location == name {
+		loc, err := s.HeadCommit()
 
-	err = json.Unmarshal(data, &content)
+		if err != nil {
+			return err
+		}
+
+		err = s.SetHeadTo(HeadContent{Detached: true, Location: loc}, "branch: deleting current branch "+name)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.DeleteBranch(name)
 
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	return content.Reference, nil
+	return nil
 }
 
-func GetBranchNames() []string {
-	names := make([]string, 0, 1)
+// BranchContent is the JSON content of the loose file of a ref.
+type BranchContent struct {
+	// Reference is the hash the ref points to, empty for symbolic refs.
+	Reference string `json:",omitempty"`
+	// Symbolic is the full name of the ref a symbolic ref points to.
+	Symbolic string `json:",omitempty"`
+}
 
-	err := util.ForeachSubfile(".lit/refs/heads", func(path string, d fs.DirEntry) error {
-		names = append(names, d.Name())
+// ReadBranch returns the hash of the commit the branch with the given name
+// points to, returning ErrNotFound if it doesn't exist.
+func (s *Store) ReadBranch(name string) (string, error) {
+	return s.readRef("refs/heads/" + name)
+}
 
-		return nil
-	})
+// GetBranchNames returns the full names of every branch, loose or packed,
+// such as feature/login, sorted by name, or nil if they cannot be listed.
+func (s *Store) GetBranchNames() []string {
+	names, err := s.listRefs("refs/heads/")
 
 	if err != nil {
 		return nil
 	}
-	
+
 	return names
-}
\ No newline at end of file
+}
@@ -0,0 +1,180 @@
+package refs
+
+import (
+	"errors"
+	"fmt"
+	"lit/util"
+	"os"
+	"strings"
+)
+
+/*
+A symbolic ref points to another ref instead of a hash, e.g. HEAD points to
+the current branch unless it is detached. Any ref can be symbolic: its loose
+file holds the full name of the ref it points to, as in
+
+	{"Symbolic": "refs/heads/main"}
+
+and reading it follows the chain of symbolic refs to a hash. HEAD is stored
+the same way in the lit directory, pointing to a hash only when detached.
+*/
+
+var (
+	// ErrNotSymbolic is returned when a symbolic ref is expected but the ref points to a hash.
+	ErrNotSymbolic = errors.New("not a symbolic ref")
+	// ErrSymbolicCycle is matched by errors.Is for every *SymbolicCycleError.
+	ErrSymbolicCycle = errors.New("symbolic ref cycle")
+)
+
+// SymbolicCycleError is returned when following symbolic refs leads back to a ref of the chain.
+type SymbolicCycleError struct {
+	// Chain holds the full names of the refs followed, ending with the first one repeated.
+	Chain []string
+}
+
+func (e *SymbolicCycleError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrSymbolicCycle, strings.Join(e.Chain, " -> "))
+}
+
+func (e *SymbolicCycleError) Is(target error) bool {
+	return target == ErrSymbolicCycle
+}
+
+// ResolveRef follows the ref with the given full name through symbolic
+// refs, returning the full name of the last ref of the chain and the hash
+// it points to. If the last ref doesn't exist, as for a branch without
+// commits, its name is returned together with ErrNotFound.
+func (s *Store) ResolveRef(ref string) (string, string, error) {
+	chain := []string{}
+
+	for {
+		for _, followed := range chain {
+			if followed == ref {
+				return ref, "", &SymbolicCycleError{append(chain, ref)}
+			}
+		}
+
+		chain = append(chain, ref)
+		content, err := s.readRefContent(ref)
+
+		if err != nil {
+			return ref, "", err
+		}
+
+		if content.Symbolic == "" {
+			return ref, content.Reference, nil
+		}
+
+		ref = content.Symbolic
+	}
+}
+
+// ReadSymbolicRef returns the full name of the ref the symbolic ref with the
+// given full name points to, without following it further.
+func (s *Store) ReadSymbolicRef(ref string) (string, error) {
+	content, err := s.readRefContent(ref)
+
+	if err != nil {
+		return "", err
+	}
+
+	if content.Symbolic == "" {
+		return "", fmt.Errorf("%w: %s", ErrNotSymbolic, ref)
+	}
+
+	return content.Symbolic, nil
+}
+
+// SetSymbolicRef points the ref with the given full name to the ref target,
+// recording reason in the reflog of HEAD if ref is HEAD. Refs pointing to a
+// hash are not replaced, except for a detached HEAD.
+func (s *Store) SetSymbolicRef(ref string, target string, reason string) error {
+	if err := checkRef(ref); err != nil {
+		return err
+	}
+
+	if err := checkRef(target); err != nil {
+		return err
+	}
+
+	if target == "HEAD" {
+		return fmt.Errorf("%w: symbolic refs cannot point to HEAD", ErrInvalidUpdate)
+	}
+
+	lock, err := util.LockFile(s.refPath(ref))
+
+	if err != nil {
+		return err
+	}
+
+	defer lock.Unlock()
+
+	if ref != "HEAD" {
+		content, err := s.readRefContent(ref)
+
+		if errors.Is(err, ErrNotFound) {
+			if err = s.checkConflict(ref); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		} else if content.Symbolic == "" {
+			return fmt.Errorf("%w: %s points to %s", ErrNotSymbolic, ref, content.Reference)
+		}
+	}
+
+	// the chain from target must not lead back to ref, nor contain a cycle of its own
+	if _, _, err = s.ResolveRef(target); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	chain := []string{ref}
+
+	for next := target; next != ""; next, _ = s.ReadSymbolicRef(next) {
+		chain = append(chain, next)
+
+		if next == ref {
+			return &SymbolicCycleError{chain}
+		}
+	}
+
+	if ref != "HEAD" {
+		return util.WriteJSON(s.refPath(ref), BranchContent{Symbolic: target})
+	}
+
+	// an unborn branch has no commit, which is recorded as such
+	old, _ := s.HeadCommit()
+
+	if err = util.WriteJSON(s.path("HEAD"), BranchContent{Symbolic: target}); err != nil {
+		return err
+	}
+
+	new, _ := s.HeadCommit()
+
+	return s.appendReflog("HEAD", old, new, reason)
+}
+
+// DeleteSymbolicRef deletes the symbolic ref with the given full name,
+// leaving the ref it points to alone.
+func (s *Store) DeleteSymbolicRef(ref string) error {
+	if ref == "HEAD" {
+		return fmt.Errorf("%w: HEAD cannot be deleted", ErrInvalidUpdate)
+	}
+
+	// runs after the lock file is removed from the directory
+	defer removeEmptyParents(s.refPath(ref), s.path("refs", strings.SplitN(ref+"/", "/", 3)[1]))
+
+	lock, err := util.LockFile(s.refPath(ref))
+
+	if err != nil {
+		return err
+	}
+
+	defer lock.Unlock()
+
+	if _, err = s.ReadSymbolicRef(ref); err != nil {
+		return err
+	}
+
+	return os.Remove(s.refPath(ref))
+}
@@ -0,0 +1,90 @@
+package refs
+
+import (
+	"errors"
+	"lit/util"
+	"path/filepath"
+)
+
+// ErrTagExists is returned by CreateTag when a tag with the name already exists.
+var ErrTagExists = errors.New("tag already exists")
+
+// tagPath returns the path of the file storing the given tag.
+func (s *Store) tagPath(name string) string {
+	return s.path("refs", "tags", filepath.FromSlash(name))
+}
+
+// TagExists checks if a tag exists with the given name.
+func (s *Store) TagExists(name string) (bool, error) {
+	exists, err := s.refExists("refs/tags/" + name)
+
+	if err != nil {
+		return false, errors.New("failed to check if tag exists")
+	}
+
+	return exists, nil
+}
+
+// CreateTag creates a tag with the given name pointing to the object with the
+// given hash, which is the tag object of annotated tags. Tags do not move, so
+// unlike branches they have no reflog.
+func (s *Store) CreateTag(name string, hash string) error {
+	if err := CheckRefName(name); err != nil {
+		return err
+	}
+
+	if err := s.checkConflict("refs/tags/" + name); err != nil {
+		return err
+	}
+
+	lock, err := util.LockFile(s.tagPath(name))
+
+	if err != nil {
+		return err
+	}
+
+	defer lock.Unlock()
+
+	exists, err := s.TagExists(name)
+
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return ErrTagExists
+	}
+
+	if exists, err := s.objects.Has(hash); err != nil || !exists {
+		return errors.New(hash + " is not the hash of an object")
+	}
+
+	return util.WriteJSON(s.tagPath(name), BranchContent{Reference: hash})
+}
+
+// ReadTag returns the hash of the object the tag with the given name points to.
+func (s *Store) ReadTag(name string) (string, error) {
+	return s.readRef("refs/tags/" + name)
+}
+
+// DeleteTag deletes a tag, returning ErrNotFound if it doesn't exist.
+func (s *Store) DeleteTag(name string) error {
+	// runs after the lock file is removed from the directory
+	defer removeEmptyParents(s.tagPath(name), s.path("refs", "tags"))
+
+	lock, err := util.LockFile(s.tagPath(name))
+
+	if err != nil {
+		return err
+	}
+
+	defer lock.Unlock()
+
+	return s.removeRef("refs/tags/" + name)
+}
+
+// GetTagNames returns the names of every tag, loose or packed, which may
+// contain slashes, sorted by name.
+func (s *Store) GetTagNames() ([]string, error) {
+	return s.listRefs("refs/tags/")
+}
@@ -0,0 +1,390 @@
+package refs
+
+import (
+	"errors"
+	"fmt"
+	"lit/objects"
+	"lit/util"
+	"os"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrRefMismatch is matched by errors.Is for every *RefMismatchError.
+	ErrRefMismatch = errors.New("ref does not have the expected value")
+	// ErrInvalidUpdate is returned by Transaction.Commit for updates that cannot be applied.
+	ErrInvalidUpdate = errors.New("invalid ref update")
+)
+
+// RefMismatchError is returned when a ref updated in a transaction does not
+// point to the expected old value, as another process changed it.
+type RefMismatchError struct {
+	Ref string
+	// Expected and Actual are the expected and actual hashes, empty for no ref.
+	Expected, Actual string
+}
+
+func (e *RefMismatchError) Error() string {
+	describe := func(hash string) string {
+		if hash == "" {
+			return "not to exist"
+		}
+
+		return "to point to " + hash
+	}
+
+	actual := "it doesn't exist"
+
+	if e.Actual != "" {
+		actual = "it points to " + e.Actual
+	}
+
+	return fmt.Sprintf("%v: expected %s %s, but %s", ErrRefMismatch, e.Ref, describe(e.Expected), actual)
+}
+
+func (e *RefMismatchError) Is(target error) bool {
+	return target == ErrRefMismatch
+}
+
+// RefUpdate is the change of a single ref in a Transaction.
+type RefUpdate struct {
+	// Ref is HEAD or the full name of a ref such as refs/heads/main.
+	// Symbolic refs such as HEAD stand for the ref they point to.
+	Ref string
+	// New is the hash the ref is set to, empty to delete the ref.
+	New string
+	// Old is the hash the ref must point to, empty if it must not exist. It
+	// is only checked if HaveOld is set.
+	Old     string
+	HaveOld bool
+	// VerifyOnly leaves the ref unchanged, only checking Old.
+	VerifyOnly bool
+	// Reason is recorded in the reflogs of branches and HEAD.
+	Reason string
+}
+
+// Transaction updates several refs all-or-nothing. Every ref is locked, every
+// expected old value checked and every new value written to the lock file of
+// its ref before the first ref is changed, so a failing update leaves all
+// refs unchanged. The lock files are then renamed into place.
+type Transaction struct {
+	store   *Store
+	updates []RefUpdate
+}
+
+// NewTransaction returns an empty transaction on the refs of the store.
+func (s *Store) NewTransaction() *Transaction {
+	return &Transaction{store: s}
+}
+
+// Add adds an update to the transaction.
+func (t *Transaction) Add(update RefUpdate) {
+	t.updates = append(t.updates, update)
+}
+
+// Update sets ref to new, or deletes it if new is empty, whatever it points to.
+func (t *Transaction) Update(ref string, new string, reason string) {
+	t.Add(RefUpdate{Ref: ref, New: new, Reason: reason})
+}
+
+// UpdateFrom sets ref to new, or deletes it if new is empty, if it points to
+// old, or doesn't exist if old is empty.
+func (t *Transaction) UpdateFrom(ref string, new string, old string, reason string) {
+	t.Add(RefUpdate{Ref: ref, New: new, Old: old, HaveOld: true, Reason: reason})
+}
+
+// Verify checks that ref points to old, or doesn't exist if old is empty.
+func (t *Transaction) Verify(ref string, old string) {
+	t.Add(RefUpdate{Ref: ref, Old: old, HaveOld: true, VerifyOnly: true})
+}
+
+// pendingUpdate is a RefUpdate being committed.
+type pendingUpdate struct {
+	RefUpdate
+	// current is the hash the ref points to before the transaction.
+	current string
+	// logHead specifies whether the update changes the commit HEAD resolves to.
+	logHead bool
+}
+
+// checkRef checks that ref is HEAD or a full ref name with a valid name after refs/.
+func checkRef(ref string) error {
+	if ref == "HEAD" {
+		return nil
+	}
+
+	if !strings.HasPrefix(ref, "refs/") {
+		return fmt.Errorf("%w: %s is not a full ref name starting with refs/", ErrInvalidUpdate, ref)
+	}
+
+	return CheckRefName(strings.TrimPrefix(ref, "refs/"))
+}
+
+// Commit applies the updates of the transaction, failing without changing
+// any ref if a ref is locked by another process, doesn't point to its
+// expected old value or cannot be set to its new value.
+func (t *Transaction) Commit() error {
+	s := t.store
+	pending := make([]*pendingUpdate, 0, len(t.updates))
+	seen := map[string]bool{}
+	headRef, _, err := s.ResolveRef("HEAD")
+
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	for _, update := range t.updates {
+		if err = checkRef(update.Ref); err != nil {
+			return err
+		}
+
+		p := &pendingUpdate{RefUpdate: update}
+
+		// updates apply to the ref at the end of a chain of symbolic refs
+		if p.Ref, _, err = s.ResolveRef(update.Ref); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+
+		p.logHead = p.Ref == headRef
+
+		if seen[p.Ref] {
+			return fmt.Errorf("%w: %s is updated more than once", ErrInvalidUpdate, p.Ref)
+		}
+
+		seen[p.Ref] = true
+		pending = append(pending, p)
+	}
+
+	// locks are always taken in the same order, HEAD last
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Ref != "HEAD" && (pending[j].Ref == "HEAD" || pending[i].Ref < pending[j].Ref)
+	})
+
+	locked := map[string]*util.Lock{}
+	locks := []*util.Lock{}
+	deleted := []string{}
+
+	defer func() {
+		// committed locks are already released
+		for i := len(locks) - 1; i >= 0; i-- {
+			locks[i].Unlock()
+		}
+
+		// directories are only empty once the lock files are removed, which
+		// also cleans up after lock files of refs that were not created
+		for _, p := range pending {
+			if p.Ref != "HEAD" {
+				kind := strings.SplitN(p.Ref, "/", 3)[1]
+				removeEmptyParents(s.refPath(p.Ref), s.path("refs", kind))
+			}
+		}
+	}()
+
+	lock := func(path string) error {
+		if locked[path] != nil {
+			return nil
+		}
+
+		l, err := util.LockFile(path)
+
+		if err != nil {
+			return err
+		}
+
+		locked[path] = l
+		locks = append(locks, l)
+
+		return nil
+	}
+
+	for _, p := range pending {
+		if err = lock(s.refPath(p.Ref)); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range pending {
+		if p.logHead && !p.VerifyOnly {
+			if err = lock(s.path("HEAD")); err != nil {
+				return err
+			}
+		}
+
+		// deleted refs may be packed
+		if p.New == "" && !p.VerifyOnly {
+			if err = lock(s.path("packed-refs")); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = t.check(pending); err != nil {
+		return err
+	}
+
+	// every new value is staged in the lock file of its ref before any ref
+	// is changed, so failing writes leave every ref unchanged
+	staged := []*util.Lock{}
+	packed, err := s.readPackedRefs()
+
+	if err != nil {
+		return err
+	}
+
+	packedChanged := false
+
+	for _, p := range pending {
+		if p.VerifyOnly {
+			continue
+		}
+
+		if p.New == "" {
+			deleted = append(deleted, p.Ref)
+
+			if _, isPacked := packed[p.Ref]; isPacked {
+				delete(packed, p.Ref)
+				packedChanged = true
+			}
+
+			continue
+		}
+
+		l := locked[s.refPath(p.Ref)]
+
+		if err = l.WriteJSON(BranchContent{Reference: p.New}); err != nil {
+			return err
+		}
+
+		staged = append(staged, l)
+	}
+
+	// deleted refs would fall back to their packed entries if their loose
+	// files were removed first, so packed-refs is replaced before anything else
+	if packedChanged {
+		l := locked[s.path("packed-refs")]
+
+		if err = l.Write(packedRefsContent(packed)); err != nil {
+			return err
+		}
+
+		staged = append([]*util.Lock{l}, staged...)
+	}
+
+	for _, l := range staged {
+		if err = l.Commit(); err != nil {
+			return err
+		}
+	}
+
+	for _, ref := range deleted {
+		if exists, _ := refFileExists(s.refPath(ref)); exists {
+			if err = os.Remove(s.refPath(ref)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, p := range pending {
+		// deleting a ref that doesn't exist changes nothing
+		if p.VerifyOnly || p.current == "" && p.New == "" {
+			continue
+		}
+
+		if strings.HasPrefix(p.Ref, "refs/heads/") {
+			if err = s.appendReflog(p.Ref, p.current, p.New, p.Reason); err != nil {
+				return err
+			}
+		}
+
+		if p.logHead {
+			if err = s.appendReflog("HEAD", p.current, p.New, p.Reason); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// check reads the current value of the refs of the pending updates, which
+// are locked, and checks that every update can be applied.
+func (t *Transaction) check(pending []*pendingUpdate) error {
+	s := t.store
+
+	for _, p := range pending {
+		var err error
+
+		if p.current, err = s.readRef(p.Ref); errors.Is(err, ErrNotFound) {
+			p.current = ""
+		} else if err != nil {
+			return err
+		}
+
+		if p.HaveOld && p.Old != p.current {
+			return &RefMismatchError{p.Ref, p.Old, p.current}
+		}
+
+		if p.VerifyOnly {
+			continue
+		}
+
+		if p.New == "" {
+			if p.Ref == "HEAD" {
+				return fmt.Errorf("%w: HEAD cannot be deleted", ErrInvalidUpdate)
+			}
+
+			continue
+		}
+
+		if p.Ref == "HEAD" || strings.HasPrefix(p.Ref, "refs/heads/") {
+			if !objects.HashIsCommit(s.objects, p.New) {
+				return fmt.Errorf("%w: %s is not the hash of a commit", ErrInvalidUpdate, p.New)
+			}
+		} else if exists, err := s.objects.Has(p.New); err != nil || !exists {
+			return fmt.Errorf("%w: %s is not the hash of an object", ErrInvalidUpdate, p.New)
+		}
+
+		if p.current == "" && p.Ref != "HEAD" {
+			if err = s.checkConflict(p.Ref); err != nil {
+				return err
+			}
+		}
+	}
+
+	// refs created together may be in each other's way as well
+	for _, p := range pending {
+		for _, other := range pending {
+			if p.current == "" && p.New != "" && !other.VerifyOnly && other.New != "" && strings.HasPrefix(p.Ref, other.Ref+"/") {
+				return &RefConflictError{p.Ref, other.Ref}
+			}
+		}
+	}
+
+	return nil
+}
+
+// deletePacked removes the refs with the given full names from
+// packed-refs. The caller must hold the lock of packed-refs.
+func (s *Store) deletePacked(refs []string) error {
+	packed, err := s.readPackedRefs()
+
+	if err != nil {
+		return err
+	}
+
+	changed := false
+
+	for _, ref := range refs {
+		if _, isPacked := packed[ref]; isPacked {
+			delete(packed, ref)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return s.writePackedRefs(packed)
+}
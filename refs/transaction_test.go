@@ -0,0 +1,270 @@
+package refs
+
+import (
+	"errors"
+	"io/fs"
+	"lit/objects"
+	"lit/util"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestStore returns a store in a temporary directory with HEAD pointing
+// to main, together with the hashes of three commits in its object store.
+func newTestStore(t *testing.T) (*Store, []string) {
+	objectStore := objects.NewMemoryStore(objects.FormatLit)
+	s := NewStore(t.TempDir(), objectStore)
+
+	if err := s.InitHead("main"); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := objects.WriteTree(objectStore, map[string]objects.TreeEntry{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commits := []string{}
+
+	for i, name := range []string{"first", "second", "third"} {
+		commit := objects.NewCommit(name, tree, time.Unix(int64(1650000000+i), 0))
+		commits = append(commits, objects.WriteCommit(objectStore, commit))
+	}
+
+	return s, commits
+}
+
+// refState is what a failing transaction must leave unchanged.
+type refState struct {
+	// Refs holds the hash of every ref by full name.
+	Refs map[string]string
+	// Reflogs holds the number of reflog entries of every ref with a reflog.
+	Reflogs map[string]int
+	// Files holds the path of every file in the directory of the store.
+	Files []string
+}
+
+func readState(t *testing.T, s *Store) refState {
+	state := refState{map[string]string{}, map[string]int{}, []string{}}
+	names, err := s.ListRefs()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range append(names, "HEAD") {
+		if _, state.Refs[name], err = s.ResolveRef(name); err != nil && !errors.Is(err, ErrNotFound) {
+			t.Fatal(err)
+		}
+	}
+
+	logs, err := s.ReflogRefs()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range logs {
+		entries, err := s.Reflog(name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		state.Reflogs[name] = len(entries)
+	}
+
+	err = filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			state.Files = append(state.Files, path)
+		}
+
+		return err
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return state
+}
+
+func TestTransactionCommit(t *testing.T) {
+	s, commits := newTestStore(t)
+
+	if err := s.CreateBranchTo("main", commits[0], "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.CreateBranchTo("old", commits[0], "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	// deleting a packed ref must not leave it pointing to its packed value
+	if _, err := s.PackRefs(); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := s.NewTransaction()
+	tx.UpdateFrom("HEAD", commits[1], commits[0], "move main through HEAD")
+	tx.UpdateFrom("refs/heads/old", "", commits[0], "delete old")
+	tx.UpdateFrom("refs/heads/feature/x", commits[2], "", "create feature/x")
+	tx.Update("refs/backup/main", commits[0], "back up main")
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"HEAD":                 commits[1],
+		"refs/heads/main":      commits[1],
+		"refs/heads/feature/x": commits[2],
+		"refs/backup/main":     commits[0],
+	}
+
+	if state := readState(t, s); !reflect.DeepEqual(state.Refs, expected) {
+		t.Errorf("refs are %v, want %v", state.Refs, expected)
+	}
+
+	entries, err := s.Reflog("refs/heads/main")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if last := entries[len(entries)-1]; last.Old != commits[0] || last.New != commits[1] {
+		t.Errorf("last reflog entry of main moves from %s to %s", last.Old, last.New)
+	}
+}
+
+func TestFailingTransactionChangesNothing(t *testing.T) {
+	s, commits := newTestStore(t)
+
+	for _, name := range []string{"main", "packed", "other"} {
+		if err := s.CreateBranchTo(name, commits[0], "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := s.PackRefs(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.SetBranchTo("other", commits[1], "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		// prepare may create files such as locks, which are removed afterwards
+		prepare func() string
+		updates func(tx *Transaction)
+		err     error
+	}{
+		{
+			name: "mismatch",
+			updates: func(tx *Transaction) {
+				tx.UpdateFrom("refs/heads/main", commits[2], commits[0], "")
+				tx.UpdateFrom("refs/heads/packed", "", commits[0], "")
+				tx.UpdateFrom("refs/heads/new", commits[2], "", "")
+				tx.UpdateFrom("refs/heads/other", commits[2], commits[0], "")
+			},
+			err: ErrRefMismatch,
+		},
+		{
+			name: "failed verify",
+			updates: func(tx *Transaction) {
+				tx.Update("HEAD", commits[2], "")
+				tx.Verify("refs/heads/other", "")
+			},
+			err: ErrRefMismatch,
+		},
+		{
+			name:    "locked ref",
+			prepare: func() string { return s.refPath("refs/heads/other") + ".lock" },
+			updates: func(tx *Transaction) {
+				tx.Update("refs/heads/main", commits[2], "")
+				tx.Update("refs/heads/other", commits[2], "")
+			},
+			err: util.ErrLocked,
+		},
+		{
+			name:    "locked packed-refs",
+			prepare: func() string { return s.path("packed-refs.lock") },
+			updates: func(tx *Transaction) {
+				tx.Update("refs/heads/main", commits[2], "")
+				tx.Update("refs/heads/packed", "", "")
+			},
+			err: util.ErrLocked,
+		},
+		{
+			name: "not a commit",
+			updates: func(tx *Transaction) {
+				tx.Update("refs/heads/main", commits[2], "")
+				tx.Update("refs/heads/new", strings.Repeat("1", len(commits[0])), "")
+			},
+			err: ErrInvalidUpdate,
+		},
+		{
+			name: "conflicting creations",
+			updates: func(tx *Transaction) {
+				tx.Update("refs/heads/main", commits[2], "")
+				tx.Update("refs/heads/a", commits[2], "")
+				tx.Update("refs/heads/a/b", commits[2], "")
+			},
+			err: ErrRefConflict,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if c.prepare != nil {
+				path := c.prepare()
+
+				if err := os.WriteFile(path, nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+
+				defer os.Remove(path)
+			}
+
+			before := readState(t, s)
+			tx := s.NewTransaction()
+			c.updates(tx)
+
+			if err := tx.Commit(); !errors.Is(err, c.err) {
+				t.Fatalf("got error %v, want %v", err, c.err)
+			}
+
+			if after := readState(t, s); !reflect.DeepEqual(before, after) {
+				t.Errorf("transaction changed\n%+v\nto\n%+v", before, after)
+			}
+		})
+	}
+}
+
+func TestRefMismatchError(t *testing.T) {
+	s, commits := newTestStore(t)
+
+	if err := s.CreateBranchTo("main", commits[1], "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := s.NewTransaction()
+	tx.UpdateFrom("refs/heads/main", commits[2], commits[0], "")
+
+	var mismatch *RefMismatchError
+
+	if err := tx.Commit(); !errors.As(err, &mismatch) {
+		t.Fatalf("got error %v, want a *RefMismatchError", err)
+	}
+
+	if mismatch.Ref != "refs/heads/main" || mismatch.Expected != commits[0] || mismatch.Actual != commits[1] {
+		t.Errorf("got %+v", mismatch)
+	}
+}
@@ -0,0 +1,185 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"lit/objects"
+	"lit/util"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+)
+
+// FormatVersion is the version of the repository format written by this
+// version of lit. Repositories of version 0 predate versioning and may hold
+// objects stored as JSON documents, which Upgrade converts.
+const FormatVersion = 1
+
+// FeatureChunking marks repositories that may hold chunked blobs.
+const FeatureChunking = "chunking"
+
+// knownFeatures holds the features this version of lit supports.
+var knownFeatures = map[string]bool{FeatureChunking: true}
+
+var (
+	// ErrUnsupportedVersion is returned when opening a repository of a newer format version than FormatVersion.
+	ErrUnsupportedVersion = errors.New("unsupported repository format version")
+	// ErrUnsupportedFeature is returned when opening a repository using a feature unknown to this version of lit.
+	ErrUnsupportedFeature = errors.New("unsupported repository feature")
+)
+
+// Config holds the settings of a repository, stored as JSON in the config
+// file of the lit directory.
+type Config struct {
+	// Version is the format version of the repository.
+	Version int `json:",omitempty"`
+	// Features lists the optional features the repository uses, which
+	// versions of lit not knowing them refuse to work with.
+	Features []string `json:",omitempty"`
+	// ObjectFormat is the name of the objects.Format the repository's objects are stored in.
+	ObjectFormat string
+	// ChunkThreshold is the size in bytes from which files are stored as
+	// chunked blobs. Zero disables chunking.
+	ChunkThreshold int64 `json:",omitempty"`
+	// GCGracePeriod is how long unreachable loose objects are kept by GC, as
+	// parsed by time.ParseDuration. Empty means DefaultGCGracePeriod.
+	GCGracePeriod string `json:",omitempty"`
+	// ReflogExpiry is how long GC keeps reflog entries, as parsed by
+	// time.ParseDuration. Empty means DefaultReflogExpiry.
+	ReflogExpiry string `json:",omitempty"`
+}
+
+// DefaultConfig is the config of repositories created without further configuration.
+var DefaultConfig = Config{Version: FormatVersion, ObjectFormat: objects.FormatLit.Name()}
+
+// validate checks that the settings of the config can be used together,
+// returning the object format it selects.
+func (c Config) validate() (objects.Format, error) {
+	if c.Version < 0 || c.Version > FormatVersion {
+		return nil, fmt.Errorf("%w %d, this version of lit supports up to %d", ErrUnsupportedVersion, c.Version, FormatVersion)
+	}
+
+	for _, feature := range c.Features {
+		if !knownFeatures[feature] {
+			return nil, fmt.Errorf("%w %q", ErrUnsupportedFeature, feature)
+		}
+	}
+
+	format, err := objects.FormatByName(c.ObjectFormat)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if c.ChunkThreshold < 0 {
+		return nil, errors.New("negative chunk threshold")
+	}
+
+	if c.ChunkThreshold > 0 && !objects.SupportsChunking(format) {
+		return nil, objects.ErrChunkingUnsupported
+	}
+
+	if _, err = c.gcGracePeriod(); err != nil {
+		return nil, err
+	}
+
+	if _, err = c.reflogExpiry(); err != nil {
+		return nil, err
+	}
+
+	return format, nil
+}
+
+// gcGracePeriod returns the grace period of GC selected by the config.
+func (c Config) gcGracePeriod() (time.Duration, error) {
+	if c.GCGracePeriod == "" {
+		return DefaultGCGracePeriod, nil
+	}
+
+	period, err := time.ParseDuration(c.GCGracePeriod)
+
+	if err != nil || period < 0 {
+		return 0, fmt.Errorf("invalid gc grace period %q", c.GCGracePeriod)
+	}
+
+	return period, nil
+}
+
+// HasFeature reports whether the repository uses the given feature.
+func (c Config) HasFeature(feature string) bool {
+	for _, f := range c.Features {
+		if f == feature {
+			return true
+		}
+	}
+
+	return false
+}
+
+// enableFeature adds feature to the features of the config.
+func (c *Config) enableFeature(feature string) {
+	if !c.HasFeature(feature) {
+		c.Features = append(c.Features, feature)
+	}
+}
+
+// reflogExpiry returns how long reflog entries are kept according to the config.
+func (c Config) reflogExpiry() (time.Duration, error) {
+	if c.ReflogExpiry == "" {
+		return DefaultReflogExpiry, nil
+	}
+
+	expiry, err := time.ParseDuration(c.ReflogExpiry)
+
+	if err != nil || expiry < 0 {
+		return 0, fmt.Errorf("invalid reflog expiry %q", c.ReflogExpiry)
+	}
+
+	return expiry, nil
+}
+
+// readConfig reads the config file of the lit directory dir. Repositories
+// created before the config file existed get the default config, and
+// repositories created before versioning get version 0.
+func readConfig(dir string) (Config, error) {
+	config := DefaultConfig
+	config.Version = 0
+
+	err := util.ReadJSON(filepath.Join(dir, "config"), &config)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return config, nil
+	}
+
+	return config, err
+}
+
+// writeConfig writes the config file of the repository.
+func (r *Repository) writeConfig() error {
+	return util.WriteJSON(filepath.Join(r.Dir, "config"), r.Config)
+}
+
+// applyConfig sets up the repository according to its config.
+func (r *Repository) applyConfig() {
+	r.Index.SetChunkThreshold(r.Config.ChunkThreshold)
+}
+
+// Identity returns the "Name <email>" identity recorded as the author of new
+// commits, taken from the LIT_AUTHOR_NAME and LIT_AUTHOR_EMAIL environment
+// variables and falling back to the name of the current user.
+func Identity() string {
+	name := os.Getenv("LIT_AUTHOR_NAME")
+	email := os.Getenv("LIT_AUTHOR_EMAIL")
+
+	if name == "" {
+		if current, err := user.Current(); err == nil {
+			name = current.Username
+		} else {
+			name = "unknown"
+		}
+	}
+
+	return name + " <" + email + ">"
+}
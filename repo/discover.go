@@ -0,0 +1,83 @@
+package repo
+
+import (
+	"errors"
+	"lit/util"
+	"path/filepath"
+	"strings"
+)
+
+// Discover opens the repository containing the directory start, walking up
+// its parent directories until one containing a lit directory is found.
+func Discover(start string) (*Repository, error) {
+	dir, err := filepath.Abs(start)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		isDir, err := util.IsDir(filepath.Join(dir, DirName))
+
+		if err == nil && isDir {
+			return Open(dir)
+		}
+
+		parent := filepath.Dir(dir)
+
+		if parent == dir {
+			return nil, ErrNotRepository
+		}
+
+		dir = parent
+	}
+}
+
+// ErrOutsideRepository is returned by RelPath for paths outside the working tree.
+var ErrOutsideRepository = errors.New("path is outside repository")
+
+// RelPath converts path, which is relative to the directory dir unless it is
+// absolute, into a slash-separated path relative to the working tree.
+func (r *Repository) RelPath(dir string, path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+
+	path, err := filepath.Abs(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	relative, err := filepath.Rel(r.WorkTree, path)
+
+	if err != nil {
+		return "", ErrOutsideRepository
+	}
+
+	relative = util.CleanPath(relative)
+
+	if relative == ".." || strings.HasPrefix(relative, "../") {
+		return "", ErrOutsideRepository
+	}
+
+	return relative, nil
+}
+
+// DisplayPath converts a slash-separated path relative to the working tree
+// into a path relative to the directory dir, for showing to the user.
+func (r *Repository) DisplayPath(dir string, path string) string {
+	dir, err := filepath.Abs(dir)
+
+	if err != nil {
+		return path
+	}
+
+	relative, err := filepath.Rel(dir, filepath.Join(r.WorkTree, filepath.FromSlash(path)))
+
+	if err != nil {
+		return path
+	}
+
+	return relative
+}
@@ -0,0 +1,310 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"lit/objects"
+	"lit/refs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// FsckObject is an object reported by Fsck.
+type FsckObject struct {
+	Hash string
+	// Type is the type of the object, or the type it was expected to have if it is missing.
+	Type string
+	// ReferencedBy is the hash of an object or the name of a ref referencing the object, if known.
+	ReferencedBy string
+}
+
+// FsckProblem is an object or ref found to be broken by Fsck.
+type FsckProblem struct {
+	// Name is the hash of the object or the name of the ref.
+	Name string
+	Err  error
+}
+
+// FsckReport lists the problems Fsck found in a repository.
+type FsckReport struct {
+	// Missing holds objects referenced by reachable objects, refs or the index that do not exist.
+	Missing []FsckObject
+	// Corrupt holds objects that cannot be decoded, do not match their hash or have an unexpected type.
+	Corrupt []FsckProblem
+	// BrokenRefs holds refs that cannot be read or do not point to a commit.
+	BrokenRefs []FsckProblem
+	// Unreachable holds every object not reachable from HEAD, a ref, a reflog or the index.
+	Unreachable []FsckObject
+	// Dangling holds the unreachable objects not referenced by any other unreachable object.
+	Dangling []FsckObject
+	// LostFound holds the paths dangling commits were written to, if requested.
+	LostFound []string
+}
+
+// OK reports whether no problems were found. Unreachable objects are not problems.
+func (report *FsckReport) OK() bool {
+	return len(report.Missing)+len(report.Corrupt)+len(report.BrokenRefs) == 0
+}
+
+// FsckOptions configures Fsck.
+type FsckOptions struct {
+	// LostFound makes Fsck write every dangling commit into the lost-found directory of the repository.
+	LostFound bool
+}
+
+// ErrUnexpectedType is reported for objects of another type than the one they are referenced as.
+var ErrUnexpectedType = errors.New("unexpected object type")
+
+// typeMatches reports whether an object of the given type may be referenced as expectedType.
+func typeMatches(expectedType string, actualType string) bool {
+	if expectedType == objects.TypeBlob {
+		return actualType == objects.TypeBlob || actualType == objects.TypeChunked
+	}
+
+	return expectedType == "" || expectedType == actualType
+}
+
+// unexpectedType returns the problem of an object of type objType referenced as another type.
+func unexpectedType(ref reference, objType string) FsckProblem {
+	return FsckProblem{ref.hash, fmt.Errorf("%w: %s referenced by %s as %s", ErrUnexpectedType, objType, ref.referencedBy, ref.expectedType)}
+}
+
+// fsckChecker holds the state of a single Fsck run.
+type fsckChecker struct {
+	r      *Repository
+	report *FsckReport
+	// types holds the type of every object checked so far
+	types map[string]string
+}
+
+// check verifies the object with the given hash, returning its type and the
+// objects it references. Objects already checked are not verified again, but
+// every reference is checked to expect the type of the object.
+func (c *fsckChecker) check(ref reference) (string, []reference, bool) {
+	if objType, checked := c.types[ref.hash]; checked {
+		if objType != "" && !typeMatches(ref.expectedType, objType) {
+			c.report.Corrupt = append(c.report.Corrupt, unexpectedType(ref, objType))
+		}
+
+		return objType, nil, false
+	}
+
+	exists, err := c.r.Objects.Has(ref.hash)
+
+	if err != nil || !exists {
+		c.types[ref.hash] = ""
+		c.report.Missing = append(c.report.Missing, FsckObject{ref.hash, ref.expectedType, ref.referencedBy})
+
+		return "", nil, false
+	}
+
+	objType, err := objects.Verify(c.r.Objects, ref.hash)
+	c.types[ref.hash] = objType
+
+	if err != nil {
+		c.report.Corrupt = append(c.report.Corrupt, FsckProblem{ref.hash, err})
+		return objType, nil, false
+	}
+
+	if !typeMatches(ref.expectedType, objType) {
+		c.report.Corrupt = append(c.report.Corrupt, unexpectedType(ref, objType))
+		return objType, nil, false
+	}
+
+	references, err := c.r.references(ref.hash, objType)
+
+	if err != nil {
+		c.report.Corrupt = append(c.report.Corrupt, FsckProblem{ref.hash, err})
+		return objType, nil, false
+	}
+
+	return objType, references, true
+}
+
+// walk checks every object reachable from the given references, returning the set of reached hashes.
+func (c *fsckChecker) walk(start []reference) map[string]bool {
+	reached := map[string]bool{}
+	pending := append([]reference(nil), start...)
+
+	for len(pending) > 0 {
+		ref := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		// objects reached again are only checked for their type
+		reached[ref.hash] = true
+
+		_, references, _ := c.check(ref)
+		pending = append(pending, references...)
+	}
+
+	return reached
+}
+
+// refTips checks HEAD and every ref below refs/, such as the branches and
+// tags, returning the objects they point to. Objects missing from the
+// repository are reported as missing, referenced by the ref.
+func (c *fsckChecker) refTips() []reference {
+	tips := []reference{}
+
+	addTip := func(name string, hash string, objType string) {
+		if hash == "" {
+			c.report.BrokenRefs = append(c.report.BrokenRefs, FsckProblem{name, errors.New("empty target")})
+			return
+		}
+
+		tips = append(tips, reference{hash, objType, name})
+	}
+
+	hc, err := c.r.Refs.ReadHead()
+
+	if err != nil {
+		c.report.BrokenRefs = append(c.report.BrokenRefs, FsckProblem{"HEAD", err})
+	} else if hc.Detached {
+		addTip("HEAD", hc.Location, objects.TypeCommit)
+	} else if err := refs.CheckRefName(hc.Location); err != nil {
+		// HEAD may point to a branch without commits yet, but not to one that cannot exist
+		c.report.BrokenRefs = append(c.report.BrokenRefs, FsckProblem{"HEAD", err})
+	}
+
+	names, err := c.r.Refs.ListRefs()
+
+	if err != nil {
+		c.report.BrokenRefs = append(c.report.BrokenRefs, FsckProblem{"refs", err})
+	}
+
+	for _, name := range names {
+		_, hash, err := c.r.Refs.ResolveRef(name)
+
+		// like HEAD, symbolic refs may point to refs without commits yet
+		if errors.Is(err, refs.ErrNotFound) {
+			continue
+		}
+
+		if err != nil {
+			c.report.BrokenRefs = append(c.report.BrokenRefs, FsckProblem{name, err})
+			continue
+		}
+
+		addTip(name, hash, refType(name))
+	}
+
+	return tips
+}
+
+// indexEntries returns the blobs staged in the index, which are reachable
+// even if they are not committed yet.
+func (c *fsckChecker) indexEntries() ([]reference, error) {
+	staged, err := c.r.Index.Staged()
+
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(staged))
+
+	for path := range staged {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	entries := make([]reference, 0, len(paths))
+
+	for _, path := range paths {
+		entries = append(entries, reference{staged[path], objects.TypeBlob, "index:" + path})
+	}
+
+	return entries, nil
+}
+
+// Fsck verifies every object reachable from HEAD, the refs, the reflogs and
+// the index, and reports missing, corrupt, unreachable and dangling objects as well as
+// broken refs and index entries referencing missing blobs.
+func (r *Repository) Fsck(options FsckOptions) (*FsckReport, error) {
+	c := &fsckChecker{r, &FsckReport{}, map[string]string{}}
+
+	entries, err := c.indexEntries()
+
+	if err != nil {
+		return nil, err
+	}
+
+	reflogs, err := r.reflogRoots()
+
+	if err != nil {
+		return nil, err
+	}
+
+	reachable := c.walk(append(append(c.refTips(), reflogs...), entries...))
+
+	unreachable := []string{}
+
+	err = r.Objects.Iterate(func(hash string) error {
+		if !reachable[hash] {
+			unreachable = append(unreachable, hash)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(unreachable)
+
+	// unreachable objects referenced by other unreachable objects are not dangling
+	referenced := map[string]bool{}
+
+	for _, hash := range unreachable {
+		_, references, _ := c.check(reference{hash, "", ""})
+
+		for _, ref := range references {
+			referenced[ref.hash] = true
+		}
+	}
+
+	for _, hash := range unreachable {
+		object := FsckObject{Hash: hash, Type: c.types[hash]}
+		c.report.Unreachable = append(c.report.Unreachable, object)
+
+		if !referenced[hash] {
+			c.report.Dangling = append(c.report.Dangling, object)
+		}
+	}
+
+	if options.LostFound {
+		if err = r.writeLostFound(c.report); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.report, nil
+}
+
+// writeLostFound writes every dangling commit of the report into the
+// lost-found/commit directory, as a file named after and containing its hash.
+func (r *Repository) writeLostFound(report *FsckReport) error {
+	dir := filepath.Join(r.Dir, "lost-found", "commit")
+
+	for _, object := range report.Dangling {
+		if object.Type != objects.TypeCommit {
+			continue
+		}
+
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, object.Hash)
+
+		if err := os.WriteFile(path, []byte(object.Hash+"\n"), 0666); err != nil {
+			return err
+		}
+
+		report.LostFound = append(report.LostFound, path)
+	}
+
+	return nil
+}
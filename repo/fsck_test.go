@@ -0,0 +1,190 @@
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"lit/objects"
+	"lit/refs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// loosePath returns the path of the loose object with the given hash.
+func loosePath(t *testing.T, r *Repository, hash string) string {
+	path, err := r.Objects.(*objects.DiskStore).Loose.HashPath(hash)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// hasObject reports whether the object with the given hash exists.
+func hasObject(t *testing.T, r *Repository, hash string) bool {
+	exists, err := r.Objects.Has(hash)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return exists
+}
+
+func fsck(t *testing.T, r *Repository) *FsckReport {
+	report, err := r.Fsck(FsckOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return report
+}
+
+func findObject(list []FsckObject, hash string) (FsckObject, bool) {
+	for _, object := range list {
+		if object.Hash == hash {
+			return object, true
+		}
+	}
+
+	return FsckObject{}, false
+}
+
+func findProblem(list []FsckProblem, name string) (FsckProblem, bool) {
+	for _, problem := range list {
+		if problem.Name == name {
+			return problem, true
+		}
+	}
+
+	return FsckProblem{}, false
+}
+
+func TestFsckHealthyRepository(t *testing.T) {
+	r, _ := newHistoryRepo(t)
+
+	if report := fsck(t, r); !report.OK() || len(report.Unreachable) != 0 {
+		t.Errorf("fsck of a healthy repository reports %+v", report)
+	}
+}
+
+func TestFsckReportsMissingObjects(t *testing.T) {
+	r, h := newHistoryRepo(t)
+
+	backup := writeTestCommit(t, r, "backup", map[string]string{"backup.txt": "backup\n"})
+
+	if err := r.UpdateRefs(refs.RefUpdate{Ref: "refs/backup/keep", New: backup}); err != nil {
+		t.Fatal(err)
+	}
+
+	tree := treeEntry(t, r, h.S, "")
+	blob := treeEntry(t, r, h.S, "side.txt")
+
+	for _, hash := range []string{backup, blob} {
+		if err := os.Remove(loosePath(t, r, hash)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report := fsck(t, r)
+
+	if report.OK() {
+		t.Fatal("fsck reports no problems")
+	}
+
+	if object, found := findObject(report.Missing, backup); !found || object.ReferencedBy != "refs/backup/keep" {
+		t.Errorf("missing commit of refs/backup/keep reported as %+v", object)
+	}
+
+	if object, found := findObject(report.Missing, blob); !found || object.Type != objects.TypeBlob || object.ReferencedBy != tree {
+		t.Errorf("missing blob reported as %+v, want a blob referenced by %s", object, tree)
+	}
+}
+
+func TestFsckReportsCorruptObjects(t *testing.T) {
+	r, h := newHistoryRepo(t)
+
+	// content of another object, which does not match the hash
+	mismatched := treeEntry(t, r, h.A, "a.txt")
+	other, err := os.ReadFile(loosePath(t, r, treeEntry(t, r, h.B, "a.txt")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.WriteFile(loosePath(t, r, mismatched), other, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// data that cannot be decoded at all
+	garbage := treeEntry(t, r, h.A, "dir")
+
+	if err = os.WriteFile(loosePath(t, r, garbage), []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a branch pointing to a blob instead of a commit, which update-ref refuses to create
+	blob := treeEntry(t, r, h.M, "side.txt")
+	content, err := json.Marshal(refs.BranchContent{Reference: blob})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.WriteFile(filepath.Join(r.Dir, "refs", "heads", "blob"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report := fsck(t, r)
+
+	for _, hash := range []string{mismatched, garbage} {
+		if problem, found := findProblem(report.Corrupt, hash); !found || !errors.Is(problem.Err, objects.ErrCorruptObject) {
+			t.Errorf("corrupt object %s reported as %+v", hash, problem)
+		}
+	}
+
+	if problem, found := findProblem(report.Corrupt, blob); !found || !errors.Is(problem.Err, ErrUnexpectedType) {
+		t.Errorf("blob of refs/heads/blob reported as %+v", problem)
+	}
+}
+
+func TestFsckReportsDanglingObjects(t *testing.T) {
+	r, _ := newHistoryRepo(t)
+
+	lost := writeTestCommit(t, r, "lost", map[string]string{"lost.txt": "lost\n"})
+	lostTree := treeEntry(t, r, lost, "")
+	blob := objects.WriteBlob(r.Objects, []byte("dangling\n"))
+
+	report, err := r.Fsck(FsckOptions{LostFound: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !report.OK() {
+		t.Errorf("unreachable objects are reported as problems: %+v", report)
+	}
+
+	for _, hash := range []string{lost, lostTree, blob} {
+		if _, found := findObject(report.Unreachable, hash); !found {
+			t.Errorf("%s is not reported as unreachable", hash)
+		}
+	}
+
+	// the tree of the lost commit is unreachable, but referenced by the commit
+	if _, found := findObject(report.Dangling, lostTree); found {
+		t.Error("the tree of a dangling commit is reported as dangling")
+	}
+
+	for _, hash := range []string{lost, blob} {
+		if _, found := findObject(report.Dangling, hash); !found {
+			t.Errorf("%s is not reported as dangling", hash)
+		}
+	}
+
+	if len(report.LostFound) != 1 || filepath.Base(report.LostFound[0]) != lost {
+		t.Errorf("wrote %v into lost-found, want the lost commit", report.LostFound)
+	}
+}
@@ -0,0 +1,98 @@
+package repo
+
+import (
+	"lit/objects"
+	"time"
+)
+
+// DefaultGCGracePeriod is how long unreachable loose objects are kept by GC
+// unless configured otherwise.
+const DefaultGCGracePeriod = 14 * 24 * time.Hour
+
+// DefaultReflogExpiry is how long GC keeps reflog entries unless configured otherwise.
+const DefaultReflogExpiry = 90 * 24 * time.Hour
+
+// GCOptions configures GC.
+type GCOptions struct {
+	// GracePeriod overrides the grace period of the config if not nil. Only
+	// unreachable objects last modified longer ago than the grace period are
+	// removed.
+	GracePeriod *time.Duration
+	// ReflogExpiry overrides the reflog expiry of the config if not nil.
+	ReflogExpiry *time.Duration
+}
+
+// GCResult describes what GC did.
+type GCResult struct {
+	// Reachable is the number of objects reachable from the repository's refs, reflogs and index.
+	Reachable int
+	// ExpiredReflogEntries is the number of reflog entries removed.
+	ExpiredReflogEntries int
+	objects.PruneResult
+}
+
+// pruner is implemented by object stores able to remove unreachable objects.
+type pruner interface {
+	Prune(keep func(hash string) bool, cutoff time.Time) (objects.PruneResult, error)
+}
+
+// GC removes the reflog entries older than the reflog expiry, then the loose
+// objects that are neither reachable from HEAD, a ref, a reflog or the index
+// nor younger than the grace period.
+func (r *Repository) GC(options GCOptions) (GCResult, error) {
+	result := GCResult{}
+	store, canPrune := r.Objects.(pruner)
+
+	if !canPrune {
+		return result, ErrNotOnDisk
+	}
+
+	gracePeriod, err := r.Config.gcGracePeriod()
+
+	if err != nil {
+		return result, err
+	}
+
+	if options.GracePeriod != nil {
+		gracePeriod = *options.GracePeriod
+	}
+
+	reflogExpiry, err := r.Config.reflogExpiry()
+
+	if err != nil {
+		return result, err
+	}
+
+	if options.ReflogExpiry != nil {
+		reflogExpiry = *options.ReflogExpiry
+	}
+
+	now := time.Now()
+	cutoff := now.Add(-gracePeriod)
+
+	result.ExpiredReflogEntries, err = r.Refs.ExpireReflogs(now.Add(-reflogExpiry))
+
+	if err != nil {
+		return result, err
+	}
+
+	roots, err := r.roots()
+
+	if err != nil {
+		return result, err
+	}
+
+	reachable, err := r.reachable(roots)
+
+	if err != nil {
+		return result, err
+	}
+
+	result.Reachable = len(reachable)
+
+	result.PruneResult, err = store.Prune(func(hash string) bool {
+		return reachable[hash]
+	}, cutoff)
+
+	return result, err
+}
@@ -0,0 +1,189 @@
+package repo
+
+import (
+	"lit/objects"
+	"lit/refs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// ageObjects makes every loose object look last modified age ago.
+func ageObjects(t *testing.T, r *Repository, age time.Duration) {
+	modified := time.Now().Add(-age)
+
+	err := r.Objects.(*objects.DiskStore).Loose.Iterate(func(hash string) error {
+		return os.Chtimes(loosePath(t, r, hash), modified, modified)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func gc(t *testing.T, r *Repository, options GCOptions) GCResult {
+	result, err := r.GC(options)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+// unreachableHistory holds the objects added by addUnreachableHistory.
+type unreachableHistory struct {
+	// reflogOnly is only reachable from the reflog of main
+	reflogOnly string
+	// tagged is only reachable from an annotated tag, taggedBlob from a lightweight tag
+	tagged, taggedBlob string
+	// backup is only reachable from the non-branch ref refs/backup/keep
+	backup string
+	// detached is only reachable from HEAD and its reflog
+	detached string
+	// staged is only reachable from the index
+	staged string
+	// old is unreachable
+	old string
+}
+
+func addUnreachableHistory(t *testing.T, r *Repository, h history) unreachableHistory {
+	var u unreachableHistory
+	var err error
+
+	u.reflogOnly = writeTestCommit(t, r, "reflog only", map[string]string{"reflog.txt": "reflog\n"}, h.M)
+	setBranch(t, r, "main", u.reflogOnly)
+	setBranch(t, r, "main", h.M)
+
+	u.tagged = writeTestCommit(t, r, "tagged", map[string]string{"tagged.txt": "tagged\n"})
+
+	if _, err = r.CreateTag("tagged", u.tagged, "only reachable from this tag", true); err != nil {
+		t.Fatal(err)
+	}
+
+	u.taggedBlob = objects.WriteBlob(r.Objects, []byte("tagged blob\n"))
+
+	if _, err = r.CreateTag("blob", u.taggedBlob, "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	u.backup = writeTestCommit(t, r, "backup", map[string]string{"backup.txt": "backup\n"})
+
+	if err = r.UpdateRefs(refs.RefUpdate{Ref: "refs/backup/keep", New: u.backup}); err != nil {
+		t.Fatal(err)
+	}
+
+	u.detached = writeTestCommit(t, r, "detached", map[string]string{"detached.txt": "detached\n"}, h.M)
+
+	if err = r.Refs.SetHeadTo(refs.HeadContent{Detached: true, Location: u.detached}, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.WriteFile(filepath.Join(r.WorkTree, "staged.txt"), []byte("staged\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = r.Add("staged.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	u.staged = objects.WriteBlob(r.Objects, []byte("staged\n"))
+	u.old = objects.WriteBlob(r.Objects, []byte("unreachable\n"))
+
+	return u
+}
+
+func TestGCPrunesUnreachableObjectsPastGracePeriod(t *testing.T) {
+	r, h := newHistoryRepo(t)
+	u := addUnreachableHistory(t, r, h)
+
+	ageObjects(t, r, 30*24*time.Hour)
+
+	recent := objects.WriteBlob(r.Objects, []byte("recent\n"))
+	result := gc(t, r, GCOptions{})
+
+	if result.Objects != 1 || result.ExpiredReflogEntries != 0 {
+		t.Errorf("removed %d objects and %d reflog entries, want only the unreachable blob", result.Objects, result.ExpiredReflogEntries)
+	}
+
+	if hasObject(t, r, u.old) {
+		t.Error("the unreachable object older than the grace period was kept")
+	}
+
+	if !hasObject(t, r, recent) {
+		t.Error("the unreachable object younger than the grace period was removed")
+	}
+
+	kept := map[string]string{
+		"the commit only in a reflog":        u.reflogOnly,
+		"the tree only in a reflog":          treeEntry(t, r, u.reflogOnly, ""),
+		"the commit of an annotated tag":     u.tagged,
+		"the blob of a lightweight tag":      u.taggedBlob,
+		"the commit of refs/backup/keep":     u.backup,
+		"the blob of refs/backup/keep":       treeEntry(t, r, u.backup, "backup.txt"),
+		"the commit of the detached HEAD":    u.detached,
+		"the blob staged in the index":       u.staged,
+		"the second parent of a merge":       h.S,
+		"a blob only in an ancestor of main": treeEntry(t, r, h.A, "a.txt"),
+	}
+
+	for description, hash := range kept {
+		if !hasObject(t, r, hash) {
+			t.Errorf("%s was removed", description)
+		}
+	}
+
+	if report := fsck(t, r); !report.OK() {
+		t.Errorf("fsck after gc reports %+v", report)
+	}
+}
+
+func TestGCGracePeriod(t *testing.T) {
+	r := newTestRepo(t)
+	blob := objects.WriteBlob(r.Objects, []byte("unreachable\n"))
+
+	ageObjects(t, r, 2*time.Hour)
+
+	week := 7 * 24 * time.Hour
+
+	if gc(t, r, GCOptions{GracePeriod: &week}); !hasObject(t, r, blob) {
+		t.Error("an unreachable object younger than the grace period was removed")
+	}
+
+	hour := time.Hour
+
+	if gc(t, r, GCOptions{GracePeriod: &hour}); hasObject(t, r, blob) {
+		t.Error("an unreachable object older than the grace period was kept")
+	}
+}
+
+func TestGCExpiresReflogs(t *testing.T) {
+	r, h := newHistoryRepo(t)
+	u := addUnreachableHistory(t, r, h)
+
+	reflogBlob := treeEntry(t, r, u.reflogOnly, "reflog.txt")
+
+	ageObjects(t, r, 30*24*time.Hour)
+
+	// every entry is older than a cutoff in the future
+	expiry := -time.Hour
+	result := gc(t, r, GCOptions{ReflogExpiry: &expiry})
+
+	if result.ExpiredReflogEntries == 0 {
+		t.Error("no reflog entry expired")
+	}
+
+	for _, hash := range []string{u.reflogOnly, reflogBlob} {
+		if hasObject(t, r, hash) {
+			t.Errorf("%s only reachable from expired reflog entries was kept", hash)
+		}
+	}
+
+	// HEAD, tags and other refs keep their objects without reflogs
+	for _, hash := range []string{u.detached, u.tagged, u.taggedBlob, u.backup, u.staged, h.M, h.X, h.Y} {
+		if !hasObject(t, r, hash) {
+			t.Errorf("%s was removed", hash)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"lit/objects"
+	"lit/util"
+	"path/filepath"
+)
+
+// ErrNotOnDisk is returned by operations that need the objects of the repository to be stored on disk.
+var ErrNotOnDisk = errors.New("objects are not stored on disk")
+
+// Repack consolidates the loose objects and packs of the repository into a
+// single pack, storing similar blobs as deltas as configured by options.
+func (r *Repository) Repack(options objects.PackOptions) (objects.RepackResult, error) {
+	diskStore, onDisk := r.Objects.(*objects.DiskStore)
+
+	if !onDisk {
+		return objects.RepackResult{}, ErrNotOnDisk
+	}
+
+	return diskStore.Repack(options)
+}
+
+// PackRefs moves the loose branches and tags of the repository into its
+// packed-refs file, returning the number of refs packed.
+func (r *Repository) PackRefs() (int, error) {
+	return r.Refs.PackRefs()
+}
+
+// UpgradeResult describes what Upgrade did.
+type UpgradeResult struct {
+	// From and To are the format versions of the repository before and after the upgrade.
+	From, To int
+	// Converted is the number of objects converted from JSON documents.
+	Converted int
+	// Corrupt holds the hashes of the JSON documents left unconverted because
+	// their content no longer matches their hash, such as binary blobs whose
+	// content was mangled by the JSON encoding.
+	Corrupt []string
+}
+
+// Upgrade migrates the repository in place to FormatVersion, converting the
+// objects stored as JSON documents by older versions of lit. Each object is
+// converted on its own and the version is only raised once every object is,
+// so an interrupted upgrade leaves a usable repository and can be resumed by
+// running Upgrade again. Objects that cannot be converted as they are corrupt
+// are left as they are and listed in the result, as fsck reports them.
+func (r *Repository) Upgrade() (UpgradeResult, error) {
+	result := UpgradeResult{From: r.Config.Version, To: r.Config.Version}
+
+	if r.Config.Version == FormatVersion {
+		return result, nil
+	}
+
+	lock, err := util.LockFile(filepath.Join(r.Dir, "config"))
+
+	if err != nil {
+		return result, err
+	}
+
+	defer lock.Unlock()
+
+	hashes := []string{}
+
+	err = r.Objects.Iterate(func(hash string) error {
+		hashes = append(hashes, hash)
+		return nil
+	})
+
+	if err != nil {
+		return result, err
+	}
+
+	for _, hash := range hashes {
+		converted, err := objects.ConvertLegacyObject(r.Objects, hash)
+
+		if errors.Is(err, objects.ErrCorruptObject) {
+			result.Corrupt = append(result.Corrupt, hash)
+			continue
+		}
+
+		if err != nil {
+			return result, fmt.Errorf("converting %s: %w", hash, err)
+		}
+
+		if converted {
+			result.Converted++
+		}
+	}
+
+	if r.Config.ChunkThreshold > 0 {
+		r.Config.enableFeature(FeatureChunking)
+	}
+
+	r.Config.Version = FormatVersion
+
+	if err = r.writeConfig(); err != nil {
+		return result, err
+	}
+
+	result.To = FormatVersion
+
+	return result, nil
+}
@@ -0,0 +1,407 @@
+package repo
+
+import (
+	"errors"
+	"lit/index"
+	"lit/objects"
+	"lit/refs"
+	"lit/set"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Add stages the file or directory at path, which is relative to the working tree.
+func (r *Repository) Add(path string) error {
+	return r.Index.Stage(path)
+}
+
+// Commit commits the content of the index with the given message, returning the hash of the new commit.
+func (r *Repository) Commit(message string) (string, error) {
+	return r.Index.Commit(message, Identity())
+}
+
+// Status describes the differences between the working tree, the index and the HEAD commit.
+type Status struct {
+	// Unstaged holds changes in the working tree not yet added to the index.
+	Unstaged map[string]index.Status
+	// Staged holds changes in the index compared to the HEAD commit.
+	Staged map[string]index.Status
+	// Untracked holds files in the working tree unknown to the index.
+	Untracked []string
+}
+
+// Status compares the working tree, the index and the HEAD commit.
+func (r *Repository) Status() (*Status, error) {
+	unstaged, staged, untracked, err := r.Index.GetStatus()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Status{unstaged, staged, untracked}, nil
+}
+
+// LogEntry is a commit together with its hash.
+type LogEntry struct {
+	Hash   string
+	Commit *objects.Commit
+}
+
+// ErrNoCommits is returned when HEAD does not point to a commit yet.
+var ErrNoCommits = errors.New("HEAD doesn't point to a commit yet")
+
+type byTime []LogEntry
+
+func (t byTime) Len() int {
+	return len(t)
+}
+
+func (t byTime) Swap(i, j int) {
+	t[i], t[j] = t[j], t[i]
+}
+
+func (t byTime) Less(i, j int) bool {
+	return t[i].Commit.Time.After(t[j].Commit.Time)
+}
+
+// Log returns the commits of the given revision ranges, as parsed by
+// ParseRevisionRange, newest first. Without revisions, it returns every
+// commit upstream of the HEAD commit.
+func (r *Repository) Log(revisions ...string) ([]LogEntry, error) {
+	if len(revisions) == 0 {
+		_, err := r.Refs.HeadCommit()
+
+		if errors.Is(err, refs.ErrNotFound) {
+			return nil, ErrNoCommits
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = []string{"HEAD"}
+	}
+
+	ranges := make([]RevisionRange, 0, len(revisions))
+
+	for _, revision := range revisions {
+		parsed, err := r.ParseRevisionRange(revision)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ranges = append(ranges, parsed)
+	}
+
+	hashes, err := r.Commits(ranges...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	commits := make([]LogEntry, 0, len(hashes))
+
+	for hash := range hashes {
+		commit, err := objects.ReadAsCommit(r.Objects, hash)
+
+		if err != nil {
+			return nil, err
+		}
+
+		commits = append(commits, LogEntry{hash, commit})
+	}
+
+	sort.Sort(byTime(commits))
+
+	return commits, nil
+}
+
+// Reflog returns the entries of the reflog of ref, newest first. The ref is
+// HEAD, a branch name or a full ref name.
+func (r *Repository) Reflog(ref string) ([]refs.ReflogEntry, error) {
+	entries, err := r.Refs.Reflog(refs.FullRefName(ref))
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+
+	return entries, nil
+}
+
+// ErrUncommittedChanges is returned by Checkout when the working tree or index contain changes.
+var ErrUncommittedChanges = errors.New("uncommitted changes")
+
+func (r *Repository) switchTo(hc refs.HeadContent) ([]string, error) {
+	// the working tree is only touched once nothing else can change HEAD or the index
+	indexLock, err := r.Index.Lock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer indexLock.Unlock()
+
+	headLock, err := r.Refs.LockHead()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer headLock.Unlock()
+
+	currentHashes, err := r.Index.Staged()
+
+	if err != nil {
+		return nil, err
+	}
+
+	currentUnstagedStatus, currentStagedStatus, currentUntracked, err := r.Index.GetStatus()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(currentUnstagedStatus)+len(currentStagedStatus) != 0 {
+		return nil, ErrUncommittedChanges
+	}
+
+	newCommitHash := hc.Location
+
+	if !hc.Detached {
+		if newCommitHash, err = r.Refs.ReadBranch(hc.Location); err != nil {
+			return nil, err
+		}
+	}
+
+	newCommitContent, err := objects.ReadAsCommit(r.Objects, newCommitHash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := r.Refs.ReadHead()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = r.Index.ClearWorkingTree(set.FromSlice(currentUntracked)); err != nil {
+		return nil, err
+	}
+
+	reason := "checkout: moving from " + previous.Location + " to " + hc.Location
+
+	if err = r.Refs.SetHeadToLocked(hc, reason); err != nil {
+		return nil, err
+	}
+
+	if err = r.Index.LoadIntoIndex(currentStagedStatus, currentHashes, newCommitContent); err != nil {
+		return nil, err
+	}
+
+	return r.Index.LoadIn(newCommitContent)
+}
+
+// Checkout points HEAD to location, which is a branch name or a revision as
+// understood by ResolveRevision, and loads the commit into the working tree.
+// Revisions other than branch names detach HEAD, as does detach for branches.
+// Checkout returns the paths of the files written to the working tree.
+func (r *Repository) Checkout(location string, detach bool) ([]string, error) {
+	exists, err := r.Refs.BranchExists(location)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if exists && !detach {
+		return r.switchTo(refs.HeadContent{Detached: false, Location: location})
+	}
+
+	hash, err := r.ResolveCommit(location)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r.switchTo(refs.HeadContent{Detached: true, Location: hash})
+}
+
+// CheckoutOrphan points HEAD to the new branch name without a commit yet,
+// keeping the working tree and the index, so the next commit starts a
+// history unrelated to the current one.
+func (r *Repository) CheckoutOrphan(name string) error {
+	if err := refs.CheckRefName(name); err != nil {
+		return err
+	}
+
+	exists, err := r.Refs.BranchExists(name)
+
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return refs.ErrBranchExists
+	}
+
+	previous, err := r.Refs.ReadHead()
+
+	if err != nil {
+		return err
+	}
+
+	reason := "checkout: moving from " + previous.Location + " to " + name
+
+	return r.Refs.SetSymbolicRef("HEAD", "refs/heads/"+name, reason)
+}
+
+// BranchInfo describes a branch.
+type BranchInfo struct {
+	Name string
+	// Current specifies whether HEAD points to the branch.
+	Current bool
+	// Hash is the hash of the commit the branch points to.
+	Hash string
+	// Subject is the first line of the message of the commit.
+	Subject string
+	// Target is the full name of the ref the branch points to if it is a
+	// symbolic ref to a ref without a commit, which leaves Hash empty.
+	Target string
+}
+
+// ErrReadBranches is returned by Branches when the branches cannot be listed.
+var ErrReadBranches = errors.New("error while reading branches")
+
+// Branches lists the branches whose names match the glob pattern, as
+// understood by path.Match, sorted by name. An empty pattern matches every branch.
+func (r *Repository) Branches(pattern string) ([]BranchInfo, error) {
+	headContent, err := r.Refs.ReadHead()
+
+	if err != nil {
+		return nil, err
+	}
+
+	names := r.Refs.GetBranchNames()
+
+	if names == nil {
+		return nil, ErrReadBranches
+	}
+
+	sort.Strings(names)
+	branches := make([]BranchInfo, 0, len(names))
+
+	for _, name := range names {
+		if pattern != "" {
+			matches, err := path.Match(pattern, name)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if !matches {
+				continue
+			}
+		}
+
+		current := !headContent.Detached && name == headContent.Location
+		hash, err := r.Refs.ReadBranch(name)
+
+		// symbolic refs may point to branches that don't exist
+		if errors.Is(err, refs.ErrNotFound) {
+			target, _ := r.Refs.ReadSymbolicRef("refs/heads/" + name)
+			branches = append(branches, BranchInfo{Name: name, Current: current, Target: target})
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		commit, err := objects.ReadAsCommit(r.Objects, hash)
+
+		if err != nil {
+			return nil, err
+		}
+
+		subject, _, _ := strings.Cut(commit.Name, "\n")
+		branches = append(branches, BranchInfo{Name: name, Current: current, Hash: hash, Subject: subject})
+	}
+
+	return branches, nil
+}
+
+// CreateBranch creates a branch with the given name pointing to the HEAD commit.
+func (r *Repository) CreateBranch(name string) error {
+	headCommit, err := r.Refs.HeadCommit()
+
+	if errors.Is(err, refs.ErrNotFound) {
+		return ErrNoCommits
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return r.Refs.CreateBranchTo(name, headCommit, "branch: Created from HEAD")
+}
+
+// CreateBranchAt creates a branch with the given name pointing to the commit
+// startPoint resolves to, as understood by ResolveRevision.
+func (r *Repository) CreateBranchAt(name string, startPoint string) error {
+	hash, err := r.ResolveCommit(startPoint)
+
+	if err != nil {
+		return err
+	}
+
+	return r.Refs.CreateBranchTo(name, hash, "branch: Created from "+startPoint)
+}
+
+// RenameBranch renames the branch old to new, keeping HEAD on it if it is the current branch.
+func (r *Repository) RenameBranch(old string, new string) error {
+	return r.Refs.RenameBranch(old, new)
+}
+
+// CopyBranch creates the branch new pointing to the same commit as old.
+func (r *Repository) CopyBranch(old string, new string) error {
+	return r.Refs.CopyBranch(old, new)
+}
+
+// SymbolicRef returns the full name of the ref the symbolic ref name points
+// to. The name is HEAD, a branch name or a full ref name.
+func (r *Repository) SymbolicRef(name string) (string, error) {
+	return r.Refs.ReadSymbolicRef(refs.FullRefName(name))
+}
+
+// SetSymbolicRef points the symbolic ref name to the ref target, which are
+// HEAD, branch names or full ref names.
+func (r *Repository) SetSymbolicRef(name string, target string, reason string) error {
+	return r.Refs.SetSymbolicRef(refs.FullRefName(name), refs.FullRefName(target), reason)
+}
+
+// DeleteSymbolicRef deletes the symbolic ref name, leaving the ref it points to alone.
+func (r *Repository) DeleteSymbolicRef(name string) error {
+	return r.Refs.DeleteSymbolicRef(refs.FullRefName(name))
+}
+
+// UpdateRefs applies the ref updates all-or-nothing in a single transaction.
+func (r *Repository) UpdateRefs(updates ...refs.RefUpdate) error {
+	t := r.Refs.NewTransaction()
+
+	for _, update := range updates {
+		t.Add(update)
+	}
+
+	return t.Commit()
+}
+
+// DeleteBranch deletes the branch with the given name, detaching HEAD if it points to the branch.
+func (r *Repository) DeleteBranch(name string) error {
+	return r.Refs.DeleteBranchSafe(name)
+}
@@ -0,0 +1,63 @@
+package repo
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// commitFile writes a file into the working tree, adds it and commits it.
+func commitFile(t *testing.T, r *Repository, name string, content string) string {
+	if err := os.WriteFile(filepath.Join(r.WorkTree, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Add(name); err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := r.Commit(name)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hash
+}
+
+func TestCommitOnOrphanBranch(t *testing.T) {
+	r := newTestRepo(t)
+	first := commitFile(t, r, "a.txt", "a\n")
+
+	if err := r.CheckoutOrphan("orphan"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Log(); !errors.Is(err, ErrNoCommits) {
+		t.Errorf("Log before the first commit of the orphan branch returns %v, want ErrNoCommits", err)
+	}
+
+	orphan := commitFile(t, r, "b.txt", "b\n")
+	log, err := r.Log()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(log) != 1 || log[0].Hash != orphan {
+		t.Fatalf("Log() returns %d entries, want only the orphan commit", len(log))
+	}
+
+	if parents := log[0].Commit.Parents; len(parents) != 0 {
+		t.Errorf("the first commit of an orphan branch has parents %v", parents)
+	}
+
+	if hash, err := r.ResolveRevision("orphan"); err != nil || hash != orphan {
+		t.Errorf("orphan resolves to %q, %v, want %q", hash, err, orphan)
+	}
+
+	if hash, err := r.ResolveRevision("main"); err != nil || hash != first {
+		t.Errorf("main resolves to %q, %v, want it unchanged", hash, err)
+	}
+}
@@ -0,0 +1,206 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"lit/objects"
+	"lit/refs"
+	"strings"
+)
+
+// reference is an object to be visited, referenced as the given type.
+type reference struct {
+	hash         string
+	expectedType string
+	referencedBy string
+}
+
+// references returns the objects referenced by the object with the given hash and type.
+func (r *Repository) references(hash string, objType string) ([]reference, error) {
+	result := []reference{}
+
+	switch objType {
+	case objects.TypeCommit:
+		commit, err := objects.ReadAsCommit(r.Objects, hash)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, reference{commit.CommitTree, objects.TypeTree, hash})
+
+		for _, parent := range commit.Parents {
+			// older lit versions recorded root commits with an empty parent
+			if parent != "" {
+				result = append(result, reference{parent, objects.TypeCommit, hash})
+			}
+		}
+	case objects.TypeTree:
+		tree, err := objects.ReadAsTree(r.Objects, hash)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range tree {
+			expectedType := objects.TypeBlob
+
+			if entry.ObjType == "Tree" {
+				expectedType = objects.TypeTree
+			}
+
+			result = append(result, reference{entry.Hash, expectedType, hash})
+		}
+	case objects.TypeTag:
+		tag, err := objects.ReadAsTag(r.Objects, hash)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, reference{tag.Target, tag.TargetType, hash})
+	case objects.TypeChunked:
+		chunks, err := objects.ReadChunks(r.Objects, hash)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, chunk := range chunks {
+			result = append(result, reference{chunk.Hash, objects.TypeBlob, hash})
+		}
+	}
+
+	return result, nil
+}
+
+// reflogRoots returns the commits recorded in the reflogs that still exist.
+// Entries may refer to commits removed before the reflog was kept.
+func (r *Repository) reflogRoots() ([]reference, error) {
+	result := []reference{}
+	names, err := r.Refs.ReflogRefs()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		entries, err := r.Refs.Reflog(name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			for _, hash := range []string{entry.Old, entry.New} {
+				if exists, err := r.Objects.Has(hash); hash != "" && err == nil && exists {
+					result = append(result, reference{hash, objects.TypeCommit, "reflog of " + name})
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// refType returns the type of object the ref with the given full name must
+// point to: branches point to commits, other refs to objects of any type.
+func refType(ref string) string {
+	if strings.HasPrefix(ref, "refs/heads/") {
+		return objects.TypeCommit
+	}
+
+	return ""
+}
+
+// roots returns the objects every reachable object is reached from: the
+// commits HEAD and the reflogs point to, the objects every ref below refs/
+// points to, such as branches and tags, and the blobs staged in the index.
+func (r *Repository) roots() ([]reference, error) {
+	result := []reference{}
+
+	hc, err := r.Refs.ReadHead()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if hc.Detached {
+		result = append(result, reference{hc.Location, objects.TypeCommit, "HEAD"})
+	}
+
+	names, err := r.Refs.ListRefs()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		_, hash, err := r.Refs.ResolveRef(name)
+
+		// symbolic refs may point to refs without commits yet, as Branches allows
+		if errors.Is(err, refs.ErrNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		result = append(result, reference{hash, refType(name), name})
+	}
+
+	reflogs, err := r.reflogRoots()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result = append(result, reflogs...)
+
+	staged, err := r.Index.Staged()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for path, hash := range staged {
+		result = append(result, reference{hash, objects.TypeBlob, "index:" + path})
+	}
+
+	return result, nil
+}
+
+// reachable returns the set of objects reachable from the given references.
+// Unlike Fsck, it stops at the first object that cannot be read.
+func (r *Repository) reachable(start []reference) (map[string]bool, error) {
+	reached := map[string]bool{}
+	pending := append([]reference(nil), start...)
+
+	for len(pending) > 0 {
+		ref := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if reached[ref.hash] {
+			continue
+		}
+
+		reached[ref.hash] = true
+
+		objType, err := objects.ReadType(r.Objects, ref.hash)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s referenced by %s: %w", ref.hash, ref.referencedBy, err)
+		}
+
+		references, err := r.references(ref.hash, objType)
+
+		if err != nil {
+			return nil, err
+		}
+
+		pending = append(pending, references...)
+	}
+
+	return reached, nil
+}
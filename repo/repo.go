@@ -0,0 +1,216 @@
+// package repo implements the Repository type, which ties together the object
+// store, refs and index of a lit repository and exposes high-level operations
+// for programs embedding lit.
+package repo
+
+import (
+	"errors"
+	"io/fs"
+	"lit/index"
+	"lit/objects"
+	"lit/refs"
+	"lit/util"
+	"os"
+	"path/filepath"
+)
+
+// DirName is the name of the directory holding the repository data inside the working tree.
+const DirName = ".lit"
+
+// DefaultBranch is the branch HEAD points to in a newly initialized repository.
+const DefaultBranch = "main"
+
+var (
+	// ErrNotRepository is returned by Open when the path is not a lit repository.
+	ErrNotRepository = errors.New("not a repository")
+	// ErrInitFileCreation is returned by Init when it cannot create a file.
+	ErrInitFileCreation = errors.New("failed to instantiate required files")
+	// ErrAlreadyRepository is returned by Init when the repository already exists.
+	ErrAlreadyRepository = errors.New("already a lit repository")
+)
+
+// Repository is a lit repository consisting of a working tree and the lit
+// directory holding its objects, refs and index.
+type Repository struct {
+	// WorkTree is the absolute path of the working tree.
+	WorkTree string
+	// Dir is the absolute path of the lit directory.
+	Dir string
+
+	Objects objects.ObjectStore
+	Refs    *refs.Store
+	Index   *index.Index
+
+	// Config holds the settings of the repository.
+	Config Config
+}
+
+// New returns a Repository with the given working tree and lit directory,
+// storing objects in objectStore. It does not check that the repository
+// exists, and uses the default config apart from the object format of objectStore.
+func New(workTree string, dir string, objectStore objects.ObjectStore) (*Repository, error) {
+	workTree, err := filepath.Abs(workTree)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err = filepath.Abs(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	refStore := refs.NewStore(dir, objectStore)
+	refStore.SetIdentity(Identity())
+
+	config := DefaultConfig
+	config.ObjectFormat = objectStore.Format().Name()
+
+	return &Repository{
+		WorkTree: workTree,
+		Dir:      dir,
+		Objects:  objectStore,
+		Refs:     refStore,
+		Index:    index.New(filepath.Join(dir, "index"), workTree, objectStore, refStore),
+		Config:   config,
+	}, nil
+}
+
+// NewWithConfig returns a Repository like New, using the given config.
+func NewWithConfig(workTree string, dir string, objectStore objects.ObjectStore, config Config) (*Repository, error) {
+	format, err := config.validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if format.Name() != objectStore.Format().Name() {
+		return nil, errors.New("object store does not match the configured object format")
+	}
+
+	r, err := New(workTree, dir, objectStore)
+
+	if err != nil {
+		return nil, err
+	}
+
+	r.Config = config
+	r.applyConfig()
+
+	return r, nil
+}
+
+// newOnDisk returns a Repository with the given working tree and lit
+// directory, keeping its objects in the lit directory.
+func newOnDisk(workTree string, dir string, config Config) (*Repository, error) {
+	format, err := config.validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	objectStore, err := objects.NewDiskStore(filepath.Join(dir, "objects"), format)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWithConfig(workTree, dir, objectStore, config)
+}
+
+// Open opens the repository whose working tree is at path.
+func Open(path string) (*Repository, error) {
+	return OpenDir(path, filepath.Join(path, DirName))
+}
+
+// OpenDir opens the repository with the given working tree and lit directory.
+func OpenDir(workTree string, dir string) (*Repository, error) {
+	isDir, err := util.IsDir(dir)
+
+	if err != nil || !isDir {
+		return nil, ErrNotRepository
+	}
+
+	config, err := readConfig(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newOnDisk(workTree, dir, config)
+}
+
+// Init initializes a new repository with the given config whose working tree is at path.
+func Init(path string, config Config) (*Repository, error) {
+	return InitDir(path, filepath.Join(path, DirName), config)
+}
+
+// InitDir initializes a new repository with the given config, working tree
+// and lit directory. The repository gets the current format version.
+func InitDir(workTree string, dir string, config Config) (*Repository, error) {
+	config.Version = FormatVersion
+
+	if config.ChunkThreshold > 0 {
+		config.enableFeature(FeatureChunking)
+	}
+
+	r, err := newOnDisk(workTree, dir, config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = r.Init(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Init creates the lit directory of the repository if possible, otherwise returns an error.
+func (r *Repository) Init() error {
+	err := os.Mkdir(r.Dir, 0777)
+
+	if errors.Is(err, fs.ErrExist) {
+		return ErrAlreadyRepository
+	} else if err != nil {
+		return ErrInitFileCreation
+	}
+
+	if _, onDisk := r.Objects.(*objects.DiskStore); onDisk {
+		err = os.Mkdir(filepath.Join(r.Dir, "objects"), 0777)
+
+		if err != nil {
+			return ErrInitFileCreation
+		}
+	}
+
+	for _, refDir := range []string{"heads", "tags"} {
+		err = os.MkdirAll(filepath.Join(r.Dir, "refs", refDir), 0777)
+
+		if err != nil {
+			return ErrInitFileCreation
+		}
+	}
+
+	err = r.writeConfig()
+
+	if err != nil {
+		return ErrInitFileCreation
+	}
+
+	err = r.Refs.InitHead(DefaultBranch)
+
+	if err != nil {
+		return ErrInitFileCreation
+	}
+
+	err = r.Index.SetDefault()
+
+	if err != nil {
+		return ErrInitFileCreation
+	}
+
+	return nil
+}
@@ -0,0 +1,572 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"lit/objects"
+	"lit/refs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrBadRevision is returned for revision expressions that cannot be parsed or resolved.
+var ErrBadRevision = errors.New("bad revision")
+
+// badRevision returns an ErrBadRevision for rev with the given explanation.
+func badRevision(rev string, format string, args ...any) error {
+	return fmt.Errorf("%w %q: %s", ErrBadRevision, rev, fmt.Sprintf(format, args...))
+}
+
+// ResolveRevision resolves a revision expression naming a single object to
+// the hash of the object. Revisions are made of a base followed by any
+// number of suffixes:
+//
+//	HEAD, @          the commit HEAD points to
+//	<tag>            the object a tag points to, also as refs/tags/<tag>
+//	<branch>         the commit a branch points to, also as refs/heads/<branch>
+//	refs/<name>      the object any ref points to, following symbolic refs
+//	<hash prefix>    the object whose hash starts with the prefix
+//	<ref>@{<n>}      the commit a ref pointed to n changes ago, from its reflog
+//	<rev>~<n>        the ancestor n generations back, following first parents
+//	<rev>^<n>        the n-th parent of a commit, ^0 being the commit itself
+//	<rev>^{<type>}   the object of the given type rev leads to, e.g. ^{tree}
+//	<rev>^{}         the object an annotated tag leads to
+//	<rev>:<path>     the blob or tree at path in the tree of rev
+//	:<path>          the blob staged for path in the index
+//
+// ~ and ^ without a number mean ~1 and ^1.
+func (r *Repository) ResolveRevision(rev string) (string, error) {
+	if base, path, found := strings.Cut(rev, ":"); found {
+		if base == "" {
+			return r.resolveStaged(rev, path)
+		}
+
+		tree, err := r.ResolveRevision(base + "^{tree}")
+
+		if err != nil {
+			return "", err
+		}
+
+		return r.resolvePath(rev, tree, path)
+	}
+
+	end := strings.IndexAny(rev, "~^")
+
+	if end < 0 {
+		end = len(rev)
+	}
+
+	hash, err := r.resolveBase(rev[:end])
+
+	if err != nil {
+		return "", err
+	}
+
+	suffix := rev[end:]
+
+	for suffix != "" {
+		operator := suffix[0]
+		suffix = suffix[1:]
+
+		if operator == '^' && strings.HasPrefix(suffix, "{") {
+			objType, rest, found := strings.Cut(suffix[1:], "}")
+
+			if !found {
+				return "", badRevision(rev, "unterminated ^{")
+			}
+
+			if hash, err = r.peel(rev, hash, objType); err != nil {
+				return "", err
+			}
+
+			suffix = rest
+			continue
+		}
+
+		if operator != '~' && operator != '^' {
+			return "", badRevision(rev, "unexpected %q", operator)
+		}
+
+		digits := len(suffix) - len(strings.TrimLeft(suffix, "0123456789"))
+		n := 1
+
+		if digits > 0 {
+			if n, err = strconv.Atoi(suffix[:digits]); err != nil {
+				return "", badRevision(rev, "invalid number %s", suffix[:digits])
+			}
+		}
+
+		suffix = suffix[digits:]
+
+		if hash, err = r.peel(rev, hash, objects.TypeCommit); err != nil {
+			return "", err
+		}
+
+		if operator == '~' {
+			for i := 0; i < n; i++ {
+				if hash, err = r.parent(rev, hash, 1); err != nil {
+					return "", err
+				}
+			}
+		} else if n > 0 {
+			if hash, err = r.parent(rev, hash, n); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return hash, nil
+}
+
+// ResolveCommit resolves a revision expression like ResolveRevision,
+// requiring it to lead to a commit.
+func (r *Repository) ResolveCommit(rev string) (string, error) {
+	hash, err := r.ResolveRevision(rev)
+
+	if err != nil {
+		return "", err
+	}
+
+	return r.peel(rev, hash, objects.TypeCommit)
+}
+
+// resolveBase resolves the part of a revision before any ~ or ^ suffix.
+func (r *Repository) resolveBase(base string) (string, error) {
+	if at := strings.Index(base, "@{"); at >= 0 && strings.HasSuffix(base, "}") {
+		return r.resolveReflog(base, base[:at], base[at+2:len(base)-1])
+	}
+
+	if base == "HEAD" || base == "@" {
+		hash, err := r.Refs.HeadCommit()
+
+		if err != nil || hash == "" {
+			return "", badRevision(base, "HEAD does not point to a commit yet")
+		}
+
+		return hash, nil
+	}
+
+	if base == "" {
+		return "", badRevision(base, "empty revision")
+	}
+
+	if hash, found, err := r.resolveRef(base); err != nil || found {
+		return hash, err
+	}
+
+	return r.resolveHashPrefix(base)
+}
+
+// resolveRef resolves a tag or branch name or a full ref name, following
+// symbolic refs, and reports whether a ref of that name exists. Tags take
+// precedence over branches of the same name, as a tag is never moved.
+func (r *Repository) resolveRef(name string) (string, bool, error) {
+	candidates := []string{"refs/tags/" + name, "refs/heads/" + name}
+
+	if strings.HasPrefix(name, "refs/") {
+		candidates = []string{name}
+	}
+
+	// hash prefixes and other names that cannot be refs are not looked up
+	if refs.CheckRefName(strings.TrimPrefix(name, "refs/")) != nil {
+		return "", false, nil
+	}
+
+	for _, ref := range candidates {
+		_, hash, err := r.Refs.ResolveRef(ref)
+
+		if errors.Is(err, refs.ErrNotFound) {
+			continue
+		}
+
+		return hash, err == nil, err
+	}
+
+	return "", false, nil
+}
+
+// resolveHashPrefix resolves the prefix of an object hash, which must be
+// shared by no other object.
+func (r *Repository) resolveHashPrefix(prefix string) (string, error) {
+	hash, err := objects.ResolveHashPrefix(r.Objects, prefix)
+
+	switch {
+	case errors.Is(err, objects.ErrInvalidHash), errors.Is(err, objects.ErrUnknownHash):
+		return "", badRevision(prefix, "unknown revision")
+	case errors.Is(err, objects.ErrHashTooShort):
+		return "", badRevision(prefix, "unknown revision, %v", err)
+	case errors.Is(err, objects.ErrAmbiguousHash):
+		return "", badRevision(prefix, "%v", err)
+	}
+
+	return hash, err
+}
+
+// resolveReflog resolves <ref>@{<n>} to the commit the ref pointed to n
+// changes ago. An empty ref stands for the current branch, or HEAD if it is
+// detached.
+func (r *Repository) resolveReflog(rev string, ref string, index string) (string, error) {
+	n, err := strconv.Atoi(index)
+
+	if err != nil || n < 0 {
+		return "", badRevision(rev, "invalid reflog index %s", index)
+	}
+
+	if ref == "" || ref == "@" {
+		hc, err := r.Refs.ReadHead()
+
+		if err != nil {
+			return "", err
+		}
+
+		ref = "HEAD"
+
+		if !hc.Detached {
+			ref = hc.Location
+		}
+	}
+
+	entries, err := r.Reflog(ref)
+
+	if err != nil {
+		return "", err
+	}
+
+	if n >= len(entries) {
+		return "", badRevision(rev, "the reflog of %s only has %d entries", ref, len(entries))
+	}
+
+	if entries[n].New == "" {
+		return "", badRevision(rev, "%s did not point to a commit", ref)
+	}
+
+	return entries[n].New, nil
+}
+
+// peel follows the object with the given hash to an object of the given
+// type: tags lead to their target and commits to their tree. An empty type
+// follows tags to the first object that is not a tag.
+func (r *Repository) peel(rev string, hash string, objType string) (string, error) {
+	actualType, err := objects.ReadType(r.Objects, hash)
+
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case objType == actualType || objType == "" && actualType != objects.TypeTag:
+		return hash, nil
+	case actualType == objects.TypeTag:
+		tag, err := objects.ReadAsTag(r.Objects, hash)
+
+		if err != nil {
+			return "", err
+		}
+
+		return r.peel(rev, tag.Target, objType)
+	case objType == objects.TypeTree && actualType == objects.TypeCommit:
+		commit, err := objects.ReadAsCommit(r.Objects, hash)
+
+		if err != nil {
+			return "", err
+		}
+
+		return commit.CommitTree, nil
+	default:
+		return "", badRevision(rev, "%s is a %s, not a %s", hash, actualType, objType)
+	}
+}
+
+// parentHashes returns the parents of a commit, leaving out the empty parent
+// older versions of lit recorded for root commits.
+func parentHashes(commit *objects.Commit) []string {
+	parents := make([]string, 0, len(commit.Parents))
+
+	for _, parent := range commit.Parents {
+		if parent != "" {
+			parents = append(parents, parent)
+		}
+	}
+
+	return parents
+}
+
+// parent returns the n-th parent of the commit with the given hash, counting from 1.
+func (r *Repository) parent(rev string, hash string, n int) (string, error) {
+	commit, err := objects.ReadAsCommit(r.Objects, hash)
+
+	if err != nil {
+		return "", err
+	}
+
+	parents := parentHashes(commit)
+
+	if n > len(parents) {
+		return "", badRevision(rev, "%s has no parent %d", hash, n)
+	}
+
+	return parents[n-1], nil
+}
+
+// resolvePath resolves the slash-separated path inside the tree with the given hash.
+func (r *Repository) resolvePath(rev string, tree string, path string) (string, error) {
+	hash := tree
+
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		if name == "" {
+			continue
+		}
+
+		entries, err := objects.ReadAsTree(r.Objects, hash)
+
+		if errors.Is(err, objects.ErrNotOfType) {
+			return "", badRevision(rev, "%s is not a directory", path)
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		entry, exists := entries[name]
+
+		if !exists {
+			return "", badRevision(rev, "path %s does not exist", path)
+		}
+
+		hash = entry.Hash
+	}
+
+	return hash, nil
+}
+
+// resolveStaged resolves the blob staged for path in the index.
+func (r *Repository) resolveStaged(rev string, path string) (string, error) {
+	staged, err := r.Index.Staged()
+
+	if err != nil {
+		return "", err
+	}
+
+	hash, exists := staged[strings.Trim(path, "/")]
+
+	if !exists {
+		return "", badRevision(rev, "path %s is not in the index", path)
+	}
+
+	return hash, nil
+}
+
+// RevisionRange is a set of commits: the commits to include together with
+// their ancestors, leaving out the commits to exclude and their ancestors.
+type RevisionRange struct {
+	Include, Exclude []string
+}
+
+// IsRevisionRange reports whether expr is a revision range rather than a
+// single revision: it starts with ^ or contains .. or ..., and names no path,
+// as paths may contain dots but ranges cannot contain paths.
+func IsRevisionRange(expr string) bool {
+	if strings.Contains(expr, ":") {
+		return false
+	}
+
+	return strings.HasPrefix(expr, "^") || strings.Contains(expr, "..")
+}
+
+// ParseRevisionRange parses a revision range, which is one of
+//
+//	<rev>         rev and its ancestors
+//	^<rev>        leaves out rev and its ancestors
+//	<a>..<b>      the ancestors of b that are not ancestors of a
+//	<a>...<b>     the ancestors of either a or b but not both
+//
+// An omitted side of .. or ... stands for HEAD. Expressions for which
+// IsRevisionRange is false are single revisions.
+func (r *Repository) ParseRevisionRange(expr string) (RevisionRange, error) {
+	result := RevisionRange{}
+
+	if !IsRevisionRange(expr) {
+		hash, err := r.ResolveCommit(expr)
+
+		if err != nil {
+			return result, err
+		}
+
+		result.Include = []string{hash}
+
+		return result, nil
+	}
+
+	if strings.HasPrefix(expr, "^") {
+		hash, err := r.ResolveCommit(expr[1:])
+
+		if err != nil {
+			return result, err
+		}
+
+		result.Exclude = []string{hash}
+
+		return result, nil
+	}
+
+	from, to, symmetric := strings.Cut(expr, "...")
+
+	if !symmetric {
+		from, to, _ = strings.Cut(expr, "..")
+	}
+
+	if from == "" {
+		from = "HEAD"
+	}
+
+	if to == "" {
+		to = "HEAD"
+	}
+
+	fromHash, err := r.ResolveCommit(from)
+
+	if err != nil {
+		return result, err
+	}
+
+	toHash, err := r.ResolveCommit(to)
+
+	if err != nil {
+		return result, err
+	}
+
+	if !symmetric {
+		result.Include = []string{toHash}
+		result.Exclude = []string{fromHash}
+
+		return result, nil
+	}
+
+	bases, err := r.MergeBases(fromHash, toHash)
+
+	if err != nil {
+		return result, err
+	}
+
+	result.Include = []string{fromHash, toHash}
+	result.Exclude = bases
+
+	return result, nil
+}
+
+// ancestors returns the given commits together with all their ancestors.
+func (r *Repository) ancestors(commits []string) (map[string]bool, error) {
+	result := map[string]bool{}
+	pending := append([]string(nil), commits...)
+
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if result[hash] {
+			continue
+		}
+
+		commit, err := objects.ReadAsCommit(r.Objects, hash)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result[hash] = true
+		pending = append(pending, parentHashes(commit)...)
+	}
+
+	return result, nil
+}
+
+// flags marking commits while looking for merge bases
+const (
+	reachableFromA = 1 << iota
+	reachableFromB
+	// belowCommon marks the ancestors of the parents of common ancestors
+	belowCommon
+)
+
+// MergeBases returns the best common ancestors of two commits: the common
+// ancestors that are not ancestors of other common ancestors. A single walk
+// marks the commits reachable from either commit, and passes a mark down
+// from every common ancestor to the common ancestors below it.
+func (r *Repository) MergeBases(a string, b string) ([]string, error) {
+	type visit struct {
+		hash  string
+		flags int
+	}
+
+	flags := map[string]int{}
+	pending := []visit{{a, reachableFromA}, {b, reachableFromB}}
+
+	for len(pending) > 0 {
+		v := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		// commits are only walked again when they gain flags, at most three times
+		if flags[v.hash]|v.flags == flags[v.hash] {
+			continue
+		}
+
+		flags[v.hash] |= v.flags
+		commit, err := objects.ReadAsCommit(r.Objects, v.hash)
+
+		if err != nil {
+			return nil, err
+		}
+
+		parentFlags := flags[v.hash]
+
+		if parentFlags&(reachableFromA|reachableFromB) == reachableFromA|reachableFromB {
+			parentFlags |= belowCommon
+		}
+
+		for _, parent := range parentHashes(commit) {
+			pending = append(pending, visit{parent, parentFlags})
+		}
+	}
+
+	bases := []string{}
+
+	for hash, f := range flags {
+		if f == reachableFromA|reachableFromB {
+			bases = append(bases, hash)
+		}
+	}
+
+	sort.Strings(bases)
+
+	return bases, nil
+}
+
+// Commits returns the commits of the given revision ranges, i.e. the
+// ancestors of every included commit that are not ancestors of an excluded one.
+func (r *Repository) Commits(ranges ...RevisionRange) (map[string]bool, error) {
+	include, exclude := []string{}, []string{}
+
+	for _, revisions := range ranges {
+		include = append(include, revisions.Include...)
+		exclude = append(exclude, revisions.Exclude...)
+	}
+
+	excluded, err := r.ancestors(exclude)
+
+	if err != nil {
+		return nil, err
+	}
+
+	included, err := r.ancestors(include)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for hash := range excluded {
+		delete(included, hash)
+	}
+
+	return included, nil
+}
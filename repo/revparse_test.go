@@ -0,0 +1,423 @@
+package repo
+
+import (
+	"errors"
+	"lit/objects"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestRepo initializes a repository in a temporary directory.
+func newTestRepo(t *testing.T) *Repository {
+	r, err := Init(t.TempDir(), DefaultConfig)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+// writeTestTree writes a tree holding files, whose names may contain slashes
+// for files in subtrees, and returns its hash.
+func writeTestTree(t *testing.T, r *Repository, files map[string]string) string {
+	entries := map[string]objects.TreeEntry{}
+	subtrees := map[string]map[string]string{}
+
+	for name, content := range files {
+		if dir, rest, nested := strings.Cut(name, "/"); nested {
+			if subtrees[dir] == nil {
+				subtrees[dir] = map[string]string{}
+			}
+
+			subtrees[dir][rest] = content
+			continue
+		}
+
+		entries[name] = objects.TreeEntry{ObjType: "Blob", Hash: objects.WriteBlob(r.Objects, []byte(content))}
+	}
+
+	for dir, subtree := range subtrees {
+		entries[dir] = objects.TreeEntry{ObjType: "Tree", Hash: writeTestTree(t, r, subtree)}
+	}
+
+	hash, err := objects.WriteTree(r.Objects, entries)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hash
+}
+
+// testCommitTime is the time of the next commit written by writeTestCommit,
+// so the commits of a test are ordered as written.
+var testCommitTime = time.Unix(1650000000, 0)
+
+// writeTestCommit writes a commit of a tree holding files with the given parents.
+func writeTestCommit(t *testing.T, r *Repository, message string, files map[string]string, parents ...string) string {
+	testCommitTime = testCommitTime.Add(time.Minute)
+
+	commit := objects.NewCommit(message, writeTestTree(t, r, files), testCommitTime)
+	commit.Parents = parents
+
+	return objects.WriteCommit(r.Objects, commit)
+}
+
+// setBranch points the branch with the given name to hash, creating it if needed.
+func setBranch(t *testing.T, r *Repository, name string, hash string) {
+	exists, err := r.Refs.BranchExists(name)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exists {
+		err = r.Refs.SetBranchTo(name, hash, "test")
+	} else {
+		err = r.Refs.CreateBranchTo(name, hash, "test")
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// history holds the commits and tags of the repository built by newHistoryRepo:
+//
+//	A - B - C - M   main, with the annotated tag v1 on B and the lightweight tag light on C
+//	 \         /
+//	  S -------     side
+//
+//	A - B1 - X      cross-x, merging B2
+//	  \    \/
+//	   \   /\
+//	    B2 - Y      cross-y, merging B1
+type history struct {
+	A, B, C, S, M, B1, B2, X, Y string
+	v1                          string
+}
+
+func newHistoryRepo(t *testing.T) (*Repository, history) {
+	r := newTestRepo(t)
+
+	var h history
+
+	h.A = writeTestCommit(t, r, "A", map[string]string{"a.txt": "one\n", "dir/b.txt": "nested\n"})
+	h.B = writeTestCommit(t, r, "B", map[string]string{"a.txt": "two\n", "dir/b.txt": "nested\n"}, h.A)
+	h.C = writeTestCommit(t, r, "C", map[string]string{"a.txt": "three\n", "dir/b.txt": "nested\n"}, h.B)
+	h.S = writeTestCommit(t, r, "S", map[string]string{"a.txt": "one\n", "side.txt": "side\n"}, h.A)
+	h.M = writeTestCommit(t, r, "M", map[string]string{"a.txt": "three\n", "dir/b.txt": "nested\n", "side.txt": "side\n"}, h.C, h.S)
+
+	h.B1 = writeTestCommit(t, r, "B1", map[string]string{"x": "1"}, h.A)
+	h.B2 = writeTestCommit(t, r, "B2", map[string]string{"x": "2"}, h.A)
+	h.X = writeTestCommit(t, r, "X", map[string]string{"x": "x"}, h.B1, h.B2)
+	h.Y = writeTestCommit(t, r, "Y", map[string]string{"x": "y"}, h.B2, h.B1)
+
+	// main moves through every commit of its first-parent history, filling its reflog
+	for _, hash := range []string{h.A, h.B, h.C, h.M} {
+		setBranch(t, r, "main", hash)
+	}
+
+	setBranch(t, r, "side", h.S)
+	setBranch(t, r, "cross-x", h.X)
+	setBranch(t, r, "cross-y", h.Y)
+
+	var err error
+
+	if h.v1, err = r.CreateTag("v1", h.B, "version 1", true); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = r.CreateTag("light", h.C, "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	return r, h
+}
+
+// treeEntry returns the hash of the entry at the slash-separated path in the tree of a commit.
+func treeEntry(t *testing.T, r *Repository, commit string, path string) string {
+	c, err := objects.ReadAsCommit(r.Objects, commit)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := c.CommitTree
+
+	for _, name := range strings.Split(path, "/") {
+		if name == "" {
+			continue
+		}
+
+		tree, err := objects.ReadAsTree(r.Objects, hash)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		hash = tree[name].Hash
+	}
+
+	return hash
+}
+
+func TestResolveRevision(t *testing.T) {
+	r, h := newHistoryRepo(t)
+
+	if err := os.WriteFile(filepath.Join(r.WorkTree, "staged.txt"), []byte("staged\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Add("staged.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		rev      string
+		expected string
+	}{
+		{"HEAD", h.M},
+		{"@", h.M},
+		{"main", h.M},
+		{"refs/heads/main", h.M},
+		{"side", h.S},
+		{h.M[:12], h.M},
+		{"HEAD~", h.C},
+		{"HEAD~1", h.C},
+		{"HEAD~3", h.A},
+		{"main~0", h.M},
+		{"main^", h.C},
+		{"main^0", h.M},
+		{"main^2", h.S},
+		{"main^^", h.B},
+		{"main^2~1", h.A},
+		{"main~2^1", h.A},
+		{"v1", h.v1},
+		{"refs/tags/v1", h.v1},
+		{"v1^{}", h.B},
+		{"v1^{commit}", h.B},
+		{"v1^{tag}", h.v1},
+		{"v1~1", h.A},
+		{"light", h.C},
+		// like in git, ^{} leaves objects other than tags as they are
+		{"main^{}", h.M},
+		{"main^{commit}", h.M},
+		{"main^{tree}", treeEntry(t, r, h.M, "")},
+		{"v1^{tree}", treeEntry(t, r, h.B, "")},
+		{"main:a.txt", treeEntry(t, r, h.M, "a.txt")},
+		{"main:dir", treeEntry(t, r, h.M, "dir")},
+		{"main:dir/b.txt", treeEntry(t, r, h.M, "dir/b.txt")},
+		{"main:/dir/b.txt/", treeEntry(t, r, h.M, "dir/b.txt")},
+		{"main~1:a.txt", treeEntry(t, r, h.C, "a.txt")},
+		{"v1:a.txt", treeEntry(t, r, h.B, "a.txt")},
+		{":staged.txt", objects.WriteBlob(r.Objects, []byte("staged\n"))},
+		{"main@{0}", h.M},
+		{"main@{1}", h.C},
+		{"main@{3}", h.A},
+		{"@{1}", h.C},
+		{"main@{1}~1", h.B},
+		{"main@{1}:a.txt", treeEntry(t, r, h.C, "a.txt")},
+	}
+
+	for _, c := range cases {
+		t.Run(c.rev, func(t *testing.T) {
+			hash, err := r.ResolveRevision(c.rev)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if hash != c.expected {
+				t.Errorf("resolved to %s, want %s", hash, c.expected)
+			}
+		})
+	}
+}
+
+func TestResolveRevisionErrors(t *testing.T) {
+	r, h := newHistoryRepo(t)
+
+	cases := []string{
+		"",
+		"nonexistent",
+		"refs/heads/nonexistent",
+		h.M[:2],
+		"main@{x}",
+		"main@{-1}",
+		"main@{4}",
+		"nonexistent@{0}",
+		"main:missing.txt",
+		"main:dir/missing.txt",
+		"main:a.txt/x",
+		":missing.txt",
+		"nonexistent:a.txt",
+		"main^3",
+		"side^2",
+		"HEAD~4",
+		"main~x",
+		"main^{tree",
+		"main^{tag}",
+		"main^{blob}",
+		"v1^{blob}",
+		"main:a.txt^{tree}",
+		"main^{tree}~1",
+	}
+
+	for _, rev := range cases {
+		t.Run(rev, func(t *testing.T) {
+			if hash, err := r.ResolveRevision(rev); err == nil {
+				t.Errorf("resolved to %s", hash)
+			}
+		})
+	}
+
+	// revisions that do not parse or name nothing fail with ErrBadRevision
+	for _, rev := range []string{"nonexistent", "main@{x}", "main@{4}", "main:missing.txt", ":missing.txt", "main^3", "main~x", "main^{tree", "main^{tag}"} {
+		if _, err := r.ResolveRevision(rev); !errors.Is(err, ErrBadRevision) {
+			t.Errorf("resolving %q gave error %v, want ErrBadRevision", rev, err)
+		}
+	}
+}
+
+func TestIsRevisionRange(t *testing.T) {
+	cases := map[string]bool{
+		"main":            false,
+		"main~2":          false,
+		"main^2":          false,
+		"^main":           true,
+		"a..b":            true,
+		"a...b":           true,
+		"..b":             true,
+		"a..":             true,
+		"main:dir/../x":   false,
+		"main:a..b":       false,
+		"a..b:path":       false,
+		":path..txt":      false,
+		"^main:a.txt":     false,
+		"main@{1}..main":  true,
+		"main^{tree}..ab": true,
+	}
+
+	for expr, expected := range cases {
+		if IsRevisionRange(expr) != expected {
+			t.Errorf("IsRevisionRange(%q) is %v, want %v", expr, !expected, expected)
+		}
+	}
+}
+
+func TestParseRevisionRange(t *testing.T) {
+	r, h := newHistoryRepo(t)
+
+	cases := []struct {
+		expr     string
+		expected RevisionRange
+	}{
+		{"main", RevisionRange{Include: []string{h.M}}},
+		{"main~1", RevisionRange{Include: []string{h.C}}},
+		{"v1", RevisionRange{Include: []string{h.B}}},
+		{"^side", RevisionRange{Exclude: []string{h.S}}},
+		{"side..main", RevisionRange{Include: []string{h.M}, Exclude: []string{h.S}}},
+		{"..side", RevisionRange{Include: []string{h.S}, Exclude: []string{h.M}}},
+		{"side..", RevisionRange{Include: []string{h.M}, Exclude: []string{h.S}}},
+		{"main~2...side", RevisionRange{Include: []string{h.B, h.S}, Exclude: []string{h.A}}},
+		{"side...", RevisionRange{Include: []string{h.S, h.M}, Exclude: []string{h.S}}},
+		{"cross-x...cross-y", RevisionRange{Include: []string{h.X, h.Y}, Exclude: sorted(h.B1, h.B2)}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.expr, func(t *testing.T) {
+			parsed, err := r.ParseRevisionRange(c.expr)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(parsed, c.expected) {
+				t.Errorf("parsed as %+v, want %+v", parsed, c.expected)
+			}
+		})
+	}
+
+	for _, expr := range []string{"main:a.txt", "main:dir/..", "main..nonexistent", "nonexistent...main", "^nonexistent", "main^{tree}..side"} {
+		if parsed, err := r.ParseRevisionRange(expr); err == nil {
+			t.Errorf("parsed %q as %+v", expr, parsed)
+		}
+	}
+}
+
+func sorted(hashes ...string) []string {
+	sort.Strings(hashes)
+	return hashes
+}
+
+func TestMergeBases(t *testing.T) {
+	r, h := newHistoryRepo(t)
+
+	cases := []struct {
+		a, b     string
+		expected []string
+	}{
+		{h.C, h.S, []string{h.A}},
+		{h.M, h.S, []string{h.S}},
+		{h.S, h.M, []string{h.S}},
+		{h.M, h.M, []string{h.M}},
+		{h.B, h.C, []string{h.B}},
+		{h.M, h.X, []string{h.A}},
+		// criss-cross merges have two best common ancestors
+		{h.X, h.Y, sorted(h.B1, h.B2)},
+	}
+
+	for _, c := range cases {
+		bases, err := r.MergeBases(c.a, c.b)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(bases, c.expected) {
+			t.Errorf("merge bases of %s and %s are %v, want %v", c.a, c.b, bases, c.expected)
+		}
+	}
+}
+
+func TestCommitsOfRanges(t *testing.T) {
+	r, h := newHistoryRepo(t)
+
+	cases := map[string][]string{
+		"side..main":        {h.B, h.C, h.M},
+		"main..side":        {},
+		"main~1...side":     {h.B, h.C, h.S},
+		"cross-x...cross-y": {h.X, h.Y},
+	}
+
+	for expr, expected := range cases {
+		parsed, err := r.ParseRevisionRange(expr)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		commits, err := r.Commits(parsed)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		hashes := []string{}
+
+		for hash := range commits {
+			hashes = append(hashes, hash)
+		}
+
+		if sort.Strings(hashes); !reflect.DeepEqual(hashes, sorted(expected...)) {
+			t.Errorf("%s holds %v, want %v", expr, hashes, sorted(expected...))
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package repo
+
+import (
+	"errors"
+	"lit/objects"
+	"lit/refs"
+	"path"
+	"sort"
+	"time"
+)
+
+// TagInfo describes a tag.
+type TagInfo struct {
+	Name string
+	// Hash is the hash of the object the tag points to, which is the tag
+	// object for annotated tags.
+	Hash string
+	// Annotation is the tag object of annotated tags, nil for lightweight tags.
+	Annotation *objects.Tag
+}
+
+// CreateTag creates a tag with the given name pointing to the object target
+// resolves to, as understood by ResolveRevision, returning the hash the tag
+// points to. Annotated tags point to a new tag object recording message,
+// lightweight tags to the object itself.
+func (r *Repository) CreateTag(name string, target string, message string, annotated bool) (string, error) {
+	if err := refs.CheckRefName(name); err != nil {
+		return "", err
+	}
+
+	hash, err := r.ResolveRevision(target)
+
+	if err != nil {
+		return "", err
+	}
+
+	if annotated {
+		targetType, err := objects.ReadType(r.Objects, hash)
+
+		if err != nil {
+			return "", err
+		}
+
+		tag := &objects.Tag{
+			Name:       name,
+			Target:     hash,
+			TargetType: targetType,
+			Tagger:     Identity(),
+			Time:       time.Now(),
+			Message:    message,
+		}
+
+		if hash = objects.WriteTag(r.Objects, tag); hash == "" {
+			return "", errors.New("failed to write tag object")
+		}
+	}
+
+	return hash, r.Refs.CreateTag(name, hash)
+}
+
+// Tag returns the tag with the given name.
+func (r *Repository) Tag(name string) (TagInfo, error) {
+	hash, err := r.Refs.ReadTag(name)
+
+	if err != nil {
+		return TagInfo{}, err
+	}
+
+	info := TagInfo{Name: name, Hash: hash}
+	objType, err := objects.ReadType(r.Objects, hash)
+
+	if err != nil || objType != objects.TypeTag {
+		return info, err
+	}
+
+	info.Annotation, err = objects.ReadAsTag(r.Objects, hash)
+
+	return info, err
+}
+
+// Tags lists the tags whose names match the glob pattern, as understood by
+// path.Match, sorted by name. An empty pattern matches every tag.
+func (r *Repository) Tags(pattern string) ([]TagInfo, error) {
+	names, err := r.Refs.GetTagNames()
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(names)
+	tags := []TagInfo{}
+
+	for _, name := range names {
+		if pattern != "" {
+			matches, err := path.Match(pattern, name)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if !matches {
+				continue
+			}
+		}
+
+		tag, err := r.Tag(name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+// DeleteTag deletes the tag with the given name. Its tag object is left to gc.
+func (r *Repository) DeleteTag(name string) error {
+	return r.Refs.DeleteTag(name)
+}
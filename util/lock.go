@@ -0,0 +1,126 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ErrLocked is returned when a file is locked by another lit process.
+var ErrLocked = errors.New("another lit process is running")
+
+// LockedError is returned by LockFile when the lock file already exists.
+type LockedError struct {
+	// Path is the path of the lock file.
+	Path string
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%v: unable to create %s; if no other lit process is running, a previous one crashed and the file can be removed", ErrLocked, e.Path)
+}
+
+// Is makes errors.Is(err, ErrLocked) match a *LockedError.
+func (e *LockedError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+// Lock is a lock on a file held by the current process. New content of the
+// locked file can be staged in the lock file with Write and put in place with
+// Commit, so that several files are only changed once the new content of
+// every one of them has been written.
+type Lock struct {
+	path string
+	// target is the path of the locked file
+	target    string
+	committed bool
+}
+
+// LockFile locks the file at path by creating the lock file <path>.lock,
+// failing with a *LockedError if it exists. Other lit processes taking the
+// lock fail until Unlock is called.
+func LockFile(path string) (*Lock, error) {
+	lockPath := path + ".lock"
+
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0777); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+
+	if errors.Is(err, fs.ErrExist) {
+		return nil, &LockedError{lockPath}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintln(file, os.Getpid())
+
+	if err = file.Close(); err != nil {
+		os.Remove(lockPath)
+		return nil, err
+	}
+
+	return &Lock{path: lockPath, target: path}, nil
+}
+
+// Write stages data as the new content of the locked file, replacing
+// anything staged before, and syncs it to disk.
+func (l *Lock) Write(data []byte) error {
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_TRUNC, 0)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// WriteJSON stages v as indented JSON, as written by WriteJSON, as the new
+// content of the locked file.
+func (l *Lock) WriteJSON(v any) error {
+	data, err := json.MarshalIndent(v, "", "\t")
+
+	if err != nil {
+		panic(err)
+	}
+
+	return l.Write(data)
+}
+
+// Commit replaces the locked file with the content staged by Write,
+// releasing the lock.
+func (l *Lock) Commit() error {
+	if err := os.Rename(l.path, l.target); err != nil {
+		return err
+	}
+
+	l.committed = true
+	SyncDir(filepath.Dir(l.target))
+
+	return nil
+}
+
+// Unlock releases the lock, discarding staged content. It does nothing once
+// the lock is committed, as the lock file is then gone.
+func (l *Lock) Unlock() error {
+	if l.committed {
+		return nil
+	}
+
+	return os.Remove(l.path)
+}
@@ -24,9 +24,11 @@ func IsDir(path string) (bool, error) {
 	return info.IsDir(), nil
 }
 
+// WriteJSON writes v as indented JSON to path using WriteFileAtomic,
+// creating missing parent directories.
 func WriteJSON(path string, v any) error {
 	data, err := json.MarshalIndent(v, "", "\t")
-	
+
 	if err != nil {
 		panic(err)
 	}
@@ -38,7 +40,66 @@ func WriteJSON(path string, v any) error {
 		return err
 	}
 
-	return os.WriteFile(path, data, 0777)
+	return WriteFileAtomic(path, data, 0644)
+}
+
+// WriteFileAtomic writes data to a temporary file next to path and renames
+// it to path once it is synced to disk, so that path holds either its old or
+// its new content even if lit is interrupted. The temporary file is named
+// after path with a leading dot, which hides it from ref listings.
+func WriteFileAtomic(path string, data []byte, perm fs.FileMode) error {
+	dir, base := filepath.Split(path)
+	temp, err := os.CreateTemp(dir, "."+base+".tmp-*")
+
+	if err != nil {
+		return err
+	}
+
+	// only fails after a successful rename, when there is nothing to clean up
+	defer os.Remove(temp.Name())
+
+	if _, err = temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+
+	if err = temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+
+	if err = temp.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Chmod(temp.Name(), perm); err != nil {
+		return err
+	}
+
+	if err = os.Rename(temp.Name(), path); err != nil {
+		return err
+	}
+
+	SyncDir(dir)
+
+	return nil
+}
+
+// SyncDir flushes the entries of dir to disk so that files renamed into it
+// survive a crash. Failures are ignored, as not every platform supports it.
+func SyncDir(dir string) {
+	if dir == "" {
+		dir = "."
+	}
+
+	file, err := os.Open(dir)
+
+	if err != nil {
+		return
+	}
+
+	file.Sync()
+	file.Close()
 }
 
 func ReadJSON(path string, v any) error {